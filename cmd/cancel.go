@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// cancelCmd represents the cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <session-id>",
+	Short: "実行中のセッションをキャンセル",
+	Long: `リモートエージェントサーバー (設定の url) に対して、
+指定したセッションのキュー内・実行中のタスクのキャンセルを要求します。
+実行中の goose は MCP 拡張の子プロセスを含めて停止され、
+キャンセルはセッションの実行履歴に記録されます。
+
+使用例:
+  goose-connect cancel org/repo/issues/123
+  goose-connect cancel org-repo-issues-123 --url http://localhost:8080`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL, err := cmd.Flags().GetString("url")
+		if err != nil {
+			log.Fatalf("Failed to get url flag: %v", err)
+		}
+		if baseURL == "" {
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				log.Fatalf("Failed to load config: %v", err)
+			}
+			baseURL = cfg.GetURL()
+		}
+
+		endpoint := strings.TrimSuffix(baseURL, "/") + "/sessions/" + url.PathEscape(args[0]) + "/cancel"
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Post(endpoint, "application/json", nil)
+		if err != nil {
+			log.Fatalf("Failed to cancel session: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalf("Failed to read response: %v", err)
+		}
+		if resp.StatusCode != http.StatusAccepted {
+			var errResp struct {
+				Error string `json:"error"`
+			}
+			if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+				log.Fatalf("Failed to cancel session: %s (%s)", errResp.Error, resp.Status)
+			}
+			log.Fatalf("Failed to cancel session: %s", resp.Status)
+		}
+
+		var records []server.TaskRecord
+		if err := json.Unmarshal(body, &records); err != nil {
+			log.Fatalf("Failed to parse response: %v", err)
+		}
+		for _, rec := range records {
+			fmt.Printf("Cancelled task %s (%s)\n", rec.ID, rec.State)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+
+	cancelCmd.Flags().String("url", "", "リモートエージェントサーバーの URL (未指定時は設定の url)")
+}
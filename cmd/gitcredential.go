@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/kommon-ai/goose-connect/pkg/gitcredential"
+	"github.com/kommon-ai/goose-connect/pkg/goose"
+	"github.com/spf13/cobra"
+)
+
+// gitCredentialCmd represents the git-credential command
+var gitCredentialCmd = &cobra.Command{
+	Use:   "git-credential <get|store|erase>",
+	Short: "セッションの env ファイルのトークンを返す git の credential helper",
+	Long: `git の credential helper として動作し、セッションの env ファイル
+(env_mode が process の場合は環境変数) の GITHUB_TOKEN を返します。goose-connect はセッションの repo の credential.helper に
+このコマンドを設定するため、リモートの URL や .git/config にトークンは保存されません。
+トークンは要求のたびに読み直すため、セッションの途中で更新できます。
+GitHub App として認証する場合は、実行中の goose-connect がソケット経由で
+有効期限の近づいたインストールトークンを更新して返します。
+
+store と erase は何もしません。
+
+使用例:
+  git config credential.helper "!goose-connect git-credential --env-file /path/to/env --host github.com"`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"get", "store", "erase"},
+	Hidden:    true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if args[0] != "get" {
+			return
+		}
+		envFilePath, err := cmd.Flags().GetString("env-file")
+		if err != nil {
+			log.Fatalf("Failed to get env-file flag: %v", err)
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.Fatalf("Failed to get host flag: %v", err)
+		}
+
+		req, err := gitcredential.Read(os.Stdin)
+		if err != nil {
+			log.Fatalf("Failed to read credential request: %v", err)
+		}
+		socket, err := cmd.Flags().GetString("socket")
+		if err != nil {
+			log.Fatalf("Failed to get socket flag: %v", err)
+		}
+		cred, err := goose.LookupCredential(goose.CredentialSource{Socket: socket, EnvFile: envFilePath}, host, req)
+		if err != nil {
+			log.Fatalf("Failed to look up credential: %v", err)
+		}
+		if cred == nil {
+			return
+		}
+		if err := gitcredential.Write(os.Stdout, cred); err != nil {
+			log.Fatalf("Failed to write credential: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitCredentialCmd)
+
+	gitCredentialCmd.Flags().String("env-file", "", "トークンを読むセッションの env ファイル (未指定時は環境変数 GITHUB_TOKEN)")
+	gitCredentialCmd.Flags().String("socket", "", "最新のトークンを返す goose-connect の UNIX ソケット (GitHub App の場合)")
+	gitCredentialCmd.Flags().String("host", "github.com", "トークンを返す対象のホスト")
+}
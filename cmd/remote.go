@@ -4,14 +4,21 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/kommon-ai/agent-connect/pkg/service"
 	"github.com/kommon-ai/goose-connect/pkg/config"
 	"github.com/kommon-ai/goose-connect/pkg/goose"
+	"github.com/kommon-ai/goose-connect/pkg/redact"
+	"github.com/kommon-ai/goose-connect/pkg/server"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +30,13 @@ var remoteCmd = &cobra.Command{
 このサーバーはGooseエージェントのリモート実行を可能にし、
 HTTPエンドポイントを通じてエージェントとの通信を提供します。
 
+タスクは非同期に実行されます。投入時に返されるタスク ID で
+GET /tasks/{id}, GET /tasks/{id}/result, POST /tasks/{id}/cancel
+から状態の確認、結果の取得、キャンセルができます。
+実行中の goose の出力は GET /tasks/{id}/output で終了まで配信されます。
+セッション単位のキャンセルは POST /sessions/{id}/cancel
+(または goose-connect cancel <session-id>) で行います。
+
 使用例:
   goose-connect remote --port 8080
 
@@ -33,10 +47,13 @@ HTTPエンドポイントを通じてエージェントとの通信を提供し
 		if err != nil {
 			log.Fatalf("Failed to get port: %v", err)
 		}
-		if err := config.ValidateRequiredValues(); err != nil {
+		// セッションごとの秘密情報は各エージェントが取り除き、ここではよく使われるトークンの形式を取り除く
+		log.SetOutput(redact.NewWriter(os.Stderr, nil))
+		cfg, err := config.NewConfig()
+		if err != nil {
 			log.Fatalf("Failed to validate config: %v", err)
 		}
-		remoteAgent := service.NewRemoteAgentServer(goose.NewGooseAgentFactory())
+		remoteAgent, _ := newRemoteAgentServer(cfg)
 
 		// ハンドラの作成
 		mux := http.NewServeMux()
@@ -44,21 +61,9 @@ HTTPエンドポイントを通じてエージェントとの通信を提供し
 		// RemoteAgentServiceハンドラの登録
 		path, handler := remoteAgent.Handler()
 		mux.Handle(path, handler)
+		registerInternalHandlers(mux, remoteAgent)
 
-		// サーバーの設定
-		srv := &http.Server{
-			Addr:           fmt.Sprintf(":%d", port),
-			Handler:        mux,
-			ReadTimeout:    10 * time.Second,
-			WriteTimeout:   10 * time.Second,
-			MaxHeaderBytes: 1 << 20, // 1MB
-		}
-
-		// サーバーの起動
-		log.Printf("Starting server on %d", port)
-		if err := srv.ListenAndServe(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
-		}
+		serve(cfg, remoteAgent, newHTTPServer(cfg, fmt.Sprintf(":%d", port), mux))
 	},
 }
 
@@ -75,3 +80,95 @@ func init() {
 	// is called directly, e.g.:
 	// remoteCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// newRemoteAgentServer は設定からエージェントのファクトリと、タスクを実行する RemoteAgentServer を作成します
+func newRemoteAgentServer(cfg *config.Config) (*server.RemoteAgentServer, *goose.GooseAgentFactory) {
+	registry, err := server.NewRegistry(cfg.GetTaskRegistryPath(), cfg.GetTaskRetention())
+	if err != nil {
+		log.Fatalf("Failed to load task registry: %v", err)
+	}
+	factory := goose.NewGooseAgentFactory()
+	host, err := goose.DefaultGitHubHost(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load GitHub URL: %v", err)
+	}
+	factory.SetGitHubHost(host)
+	factory.SetHooks(goose.NewStatusReporter(cfg), goose.FailureCommentHook{})
+	app, err := goose.NewGitHubApp(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load GitHub App: %v", err)
+	}
+	if app != nil {
+		log.Printf("Authenticating as GitHub App %d", app.ID)
+		factory.SetGitHubApp(app)
+	}
+	remoteAgent := server.NewRemoteAgentServer(factory, server.Limits{
+		MaxConcurrent: cfg.GetMaxConcurrentSessions(),
+		MaxQueued:     cfg.GetMaxQueueSize(),
+		MaxPerRepo:    cfg.GetMaxConcurrentSessionsPerRepo(),
+		MaxPerOrg:     cfg.GetMaxConcurrentSessionsPerOrg(),
+	}, registry)
+	return remoteAgent, factory
+}
+
+// registerInternalHandlers はタスクの操作とメトリクスのエンドポイントを mux に登録します
+// 認証がないため、信頼できるネットワークからだけ到達できるリスナーに登録します
+func registerInternalHandlers(mux *http.ServeMux, remoteAgent *server.RemoteAgentServer) {
+	// タスクの状態・結果・キャンセルのエンドポイントの登録
+	remoteAgent.RegisterTaskHandlers(mux)
+
+	// GitHub API のレート制限の残りなどのメトリクス
+	mux.Handle("/debug/vars", expvar.Handler())
+}
+
+// newHTTPServer は addr で handler を提供するサーバーを作成します
+// 出力の配信のようにタスクの終了まで続くリクエストは、シャットダウンの開始時にコンテキストをキャンセルして終わらせます
+func newHTTPServer(cfg *config.Config, addr string, handler http.Handler) *http.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    cfg.GetServerReadTimeout(),
+		WriteTimeout:   cfg.GetServerWriteTimeout(),
+		MaxHeaderBytes: 1 << 20, // 1MB
+		BaseContext:    func(net.Listener) context.Context { return ctx },
+	}
+	srv.RegisterOnShutdown(cancel)
+	return srv
+}
+
+// serve は servers を起動し、シグナルを受け取ると新しいリクエストの受け付けを停止して
+// 実行中のセッションを待ってから停止します
+func serve(cfg *config.Config, remoteAgent *server.RemoteAgentServer, servers ...*http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			log.Printf("Starting server on %s", srv.Addr)
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Failed to start server: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// 新しいリクエストの受け付けを停止してから、実行中のセッションを待つ
+	gracePeriod := cfg.GetShutdownGracePeriod()
+	log.Printf("Received shutdown signal, waiting up to %s for running sessions", gracePeriod)
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHTTP()
+	for _, srv := range servers {
+		if err := srv.Shutdown(httpCtx); err != nil {
+			log.Printf("Failed to shut down HTTP server on %s: %v", srv.Addr, err)
+		}
+	}
+	graceCtx, cancelGrace := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelGrace()
+	remoteAgent.Shutdown(graceCtx, goose.ErrInterrupted)
+	log.Printf("Server stopped")
+}
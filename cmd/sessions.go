@@ -0,0 +1,300 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "セッションの参照と削除",
+	Long: `base_dir 配下に保存されたセッションを参照・削除します。
+
+使用例:
+  goose-connect sessions list
+  goose-connect sessions inspect org-repo-issues-123
+  goose-connect sessions show org-repo-issues-123
+  goose-connect sessions gc --older-than 72h --keep-last 10
+  goose-connect sessions rm org-repo-issues-123`,
+}
+
+// sessionsListCmd represents the sessions list command
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "セッションの一覧を表示",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		infos, err := session.List(loadBaseDir())
+		if err != nil {
+			log.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(infos) == 0 {
+			fmt.Println("No sessions found")
+			return
+		}
+		var total int64
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tRUNS\tLAST STATUS\tLAST ACTIVITY\tSIZE")
+		for _, info := range infos {
+			status := "-"
+			if last := info.LastRun(); last != nil {
+				status = string(last.Status)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+				info.ID, len(info.Runs), status, info.LastActivity.Format(time.RFC3339), formatBytes(info.SizeBytes))
+			total += info.SizeBytes
+		}
+		w.Flush()
+		fmt.Printf("\n%d sessions, %s total\n", len(infos), formatBytes(total))
+	},
+}
+
+// sessionsInspectCmd represents the sessions inspect command
+var sessionsInspectCmd = &cobra.Command{
+	Use:   "inspect <session-id>",
+	Short: "セッションディレクトリの内容を表示",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		info, err := session.Inspect(loadBaseDir(), args[0])
+		if err != nil {
+			log.Fatalf("Failed to inspect session: %v", err)
+		}
+		fmt.Printf("Session:       %s\n", info.ID)
+		fmt.Printf("Directory:     %s\n", info.Dir)
+		fmt.Printf("Size:          %s\n", formatBytes(info.SizeBytes))
+		fmt.Printf("Last activity: %s\n", info.LastActivity.Format(time.RFC3339))
+		fmt.Printf("Runs:          %d\n", len(info.Runs))
+		if last := info.LastRun(); last != nil {
+			fmt.Printf("Last run:      #%d %s (exit %d)\n", last.Number, last.Status, last.ExitCode)
+		}
+		fmt.Println("Layout:")
+		for _, entry := range []struct {
+			name    string
+			present bool
+		}{
+			{session.RepoDirName + "/", info.HasRepo},
+			{session.InstructionFileName, info.HasInstruction},
+			{session.EnvFileName, info.HasEnv},
+			{session.ScriptFileName, info.HasScript},
+		} {
+			mark := "missing"
+			if entry.present {
+				mark = "present"
+			}
+			fmt.Printf("  %-18s %s\n", entry.name, mark)
+		}
+	},
+}
+
+// sessionsGCCmd represents the sessions gc command
+var sessionsGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "古いセッションを削除",
+	Long: `最終更新から --older-than 以上経過したセッションを削除します。
+新しい順に --keep-last 件のセッションと、実行中のセッションは削除しません。
+
+使用例:
+  goose-connect sessions gc --older-than 72h --keep-last 10
+  goose-connect sessions gc --older-than 24h --dry-run`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			log.Fatalf("Failed to get older-than: %v", err)
+		}
+		keepLast, err := cmd.Flags().GetInt("keep-last")
+		if err != nil {
+			log.Fatalf("Failed to get keep-last: %v", err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalf("Failed to get dry-run: %v", err)
+		}
+		baseDir := loadBaseDir()
+		infos, err := session.List(baseDir)
+		if err != nil {
+			log.Fatalf("Failed to list sessions: %v", err)
+		}
+
+		var freed int64
+		garbage := session.SelectGarbage(infos, olderThan, keepLast, time.Now())
+		for _, info := range garbage {
+			if dryRun {
+				fmt.Printf("Would remove %s (%s)\n", info.ID, formatBytes(info.SizeBytes))
+				freed += info.SizeBytes
+				continue
+			}
+			if err := session.Remove(baseDir, info.ID); err != nil {
+				log.Printf("Failed to remove session %s: %v", info.ID, err)
+				continue
+			}
+			fmt.Printf("Removed %s (%s)\n", info.ID, formatBytes(info.SizeBytes))
+			freed += info.SizeBytes
+		}
+		fmt.Printf("%d of %d sessions, %s freed\n", len(garbage), len(infos), formatBytes(freed))
+	},
+}
+
+// sessionsRmCmd represents the sessions rm command
+var sessionsRmCmd = &cobra.Command{
+	Use:   "rm <session-id>...",
+	Short: "セッションを削除",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Fatalf("Failed to get force: %v", err)
+		}
+		baseDir := loadBaseDir()
+		failed := false
+		for _, id := range args {
+			info, err := session.Inspect(baseDir, id)
+			if err != nil {
+				log.Printf("Failed to inspect session %s: %v", id, err)
+				failed = true
+				continue
+			}
+			if info.IsRunning() && !force {
+				log.Printf("Session %s is running, use --force to remove it", id)
+				failed = true
+				continue
+			}
+			if err := session.Remove(baseDir, id); err != nil {
+				log.Printf("Failed to remove session %s: %v", id, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("Removed %s (%s)\n", info.ID, formatBytes(info.SizeBytes))
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// sessionsShowCmd represents the sessions show command
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <session-id>",
+	Short: "セッションの実行履歴を表示",
+	Long: `セッションの実行履歴 (runs/<n>/run.json) を一覧表示します。
+--run を指定すると、その実行の詳細とトランスクリプトを表示します。
+
+使用例:
+  goose-connect sessions show org-repo-issues-123
+  goose-connect sessions show org-repo-issues-123 --run 2`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runNumber, err := cmd.Flags().GetInt("run")
+		if err != nil {
+			log.Fatalf("Failed to get run: %v", err)
+		}
+		info, err := session.Inspect(loadBaseDir(), args[0])
+		if err != nil {
+			log.Fatalf("Failed to inspect session: %v", err)
+		}
+
+		if runNumber > 0 {
+			if err := showRun(info.Dir, runNumber); err != nil {
+				log.Fatalf("Failed to show run: %v", err)
+			}
+			return
+		}
+
+		runs := info.Runs
+		fmt.Printf("Session: %s\n", info.Dir)
+		if len(runs) == 0 {
+			fmt.Println("No runs recorded")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tSTATUS\tEXIT\tSTARTED\tDURATION\tPROVIDER\tMODEL")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n",
+				r.Number, r.Status, r.ExitCode, r.StartedAt.Format(time.RFC3339),
+				r.Duration.Round(time.Second), r.Provider, r.Model)
+		}
+		w.Flush()
+	},
+}
+
+// loadBaseDir は設定からセッションの保存先を返します
+func loadBaseDir() string {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	return cfg.GetBaseDir()
+}
+
+// formatBytes はバイト数を人が読みやすい単位に変換します
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func showRun(sessionDir string, n int) error {
+	run, err := session.ReadRun(sessionDir, n)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Run:         %d\n", run.Number)
+	fmt.Printf("Status:      %s\n", run.Status)
+	fmt.Printf("Exit code:   %d\n", run.ExitCode)
+	fmt.Printf("Started:     %s\n", run.StartedAt.Format(time.RFC3339))
+	if !run.FinishedAt.IsZero() {
+		fmt.Printf("Finished:    %s\n", run.FinishedAt.Format(time.RFC3339))
+	}
+	fmt.Printf("Duration:    %s\n", run.Duration.Round(time.Second))
+	fmt.Printf("Provider:    %s\n", run.Provider)
+	fmt.Printf("Model:       %s\n", run.Model)
+	fmt.Printf("Instruction: %s\n", run.InstructionHash)
+	if run.Error != "" {
+		fmt.Printf("Error:       %s\n", run.Error)
+	}
+
+	transcript, err := os.ReadFile(filepath.Join(session.RunDir(sessionDir, n), session.TranscriptFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read transcript: %w", err)
+	}
+	fmt.Println("--- transcript ---")
+	fmt.Print(string(transcript))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsInspectCmd)
+	sessionsCmd.AddCommand(sessionsShowCmd)
+	sessionsCmd.AddCommand(sessionsGCCmd)
+	sessionsCmd.AddCommand(sessionsRmCmd)
+
+	sessionsShowCmd.Flags().Int("run", 0, "表示する実行番号 (指定時はトランスクリプトも表示)")
+	sessionsGCCmd.Flags().Duration("older-than", 72*time.Hour, "この期間以上更新のないセッションを削除")
+	sessionsGCCmd.Flags().Int("keep-last", 0, "新しい順にこの件数のセッションは削除しない")
+	sessionsGCCmd.Flags().Bool("dry-run", false, "削除せずに対象のみ表示")
+	sessionsRmCmd.Flags().Bool("force", false, "実行中のセッションも削除")
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/redact"
+	"github.com/kommon-ai/goose-connect/pkg/webhook"
+	"github.com/spf13/cobra"
+)
+
+// webhookCmd represents the webhook command
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "GitHub の Webhook を受け取ってセッションを開始するサーバーを起動",
+	Long: `GitHub の Webhook を POST /webhook で受け取り、イベントから直接セッションを開始します。
+署名 (X-Hub-Signature-256) は設定の webhook_secret で検証します。
+
+次のイベントでセッションを開始します。
+  issues                       webhook_trigger_label のラベルが付いた、または webhook_mention を含む issue が作成された
+  pull_request                 webhook_trigger_label のラベルが付いた
+  issue_comment                webhook_mention を含むコメントが投稿された
+  pull_request_review_comment  webhook_mention を含むレビューコメントが投稿された
+
+セッション ID は issue/PR の URL のパス (org/repo/issues/123 など) です。
+--port のリスナーには POST /webhook と GET /healthz だけを置きます。
+タスクの状態の確認とキャンセル (remote と同じ /tasks, /sessions) とメトリクス (/debug/vars) は
+認証がないため、設定の webhook_internal_addr (既定は 127.0.0.1:8081) の内部向けのリスナーに置きます。
+
+使用例:
+  GOOSECONNECT_WEBHOOK_SECRET=... GOOSECONNECT_WEBHOOK_API_KEY=... goose-connect webhook --port 8080`,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Failed to get port: %v", err)
+		}
+		log.SetOutput(redact.NewWriter(os.Stderr, nil))
+		cfg, err := config.NewConfig()
+		if err != nil {
+			log.Fatalf("Failed to validate config: %v", err)
+		}
+		if port == 0 {
+			port = cfg.GetPort()
+		}
+		secret := cfg.GetWebhookSecret()
+		if secret == "" {
+			log.Fatalf("webhook_secret is required to verify webhook signatures")
+		}
+		providerName, model, apiKey := cfg.GetWebhookProvider()
+		if model == "" {
+			log.Fatalf("webhook_model is required")
+		}
+		token := cfg.GetWebhookGitHubToken()
+		if cfg.GetGitHubAppID() == 0 && token == "" {
+			log.Fatalf("webhook_github_token is required unless github_app_id is set")
+		}
+
+		remoteAgent, factory := newRemoteAgentServer(cfg)
+		receiver := &webhook.Receiver{
+			Secret:    []byte(secret),
+			Submitter: remoteAgent,
+			Trigger:   cfg.GetWebhookTrigger(),
+			Provider:  providerName,
+			Model:     model,
+			APIKey:    apiKey,
+			Token:     token,
+			Client:    factory.GitHubClient,
+		}
+
+		// インターネットから到達できるリスナーには署名を検証する Webhook だけを置く
+		mux := http.NewServeMux()
+		mux.Handle("POST /webhook", receiver)
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok\n"))
+		})
+		servers := []*http.Server{newHTTPServer(cfg, fmt.Sprintf(":%d", port), mux)}
+
+		// タスクの操作とメトリクスは認証がないため、内部向けの別のリスナーに置く
+		if addr := cfg.GetWebhookInternalAddr(); addr != "" {
+			internal := http.NewServeMux()
+			registerInternalHandlers(internal, remoteAgent)
+			servers = append(servers, newHTTPServer(cfg, addr, internal))
+		}
+		serve(cfg, remoteAgent, servers...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+	webhookCmd.Flags().Int("port", 0, "リッスンするポート (0 の場合は設定の port)")
+}
@@ -3,15 +3,16 @@ module github.com/kommon-ai/goose-connect
 go 1.23.1
 
 require (
+	github.com/bufbuild/connect-go v1.10.0
 	github.com/google/go-github/v57 v57.0.0
 	github.com/kommon-ai/agent-connect v0.6.0
 	github.com/kommon-ai/agent-go v0.0.0-20250328060749-49cf120543d9
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.15.0
+	google.golang.org/protobuf v1.36.1
 )
 
 require (
-	github.com/bufbuild/connect-go v1.10.0 // indirect
 	github.com/fsnotify/fsnotify v1.8.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
@@ -27,7 +28,6 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	google.golang.org/protobuf v1.36.1 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
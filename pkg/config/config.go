@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,14 +13,145 @@ type Config struct {
 	InstructionPath string `mapstructure:"instruction_path"`
 }
 
+// GitIdentity はコミットの作成者と署名の設定です
+type GitIdentity struct {
+	Name  string `mapstructure:"name"`
+	Email string `mapstructure:"email"`
+	// SigningKey は署名に使う鍵のパスです (ssh の場合は秘密鍵または公開鍵、openpgp の場合は ASCII armor の秘密鍵)
+	SigningKey string `mapstructure:"signing_key"`
+	// SigningFormat は ssh または openpgp です
+	SigningFormat string `mapstructure:"signing_format"`
+}
+
+// StatusLabels はセッションの状態ごとに issue/PR に付けるラベルです (空の状態にはラベルを付けません)
+type StatusLabels struct {
+	Queued    string
+	Running   string
+	Succeeded string
+	Failed    string
+}
+
+// WebhookTrigger は GitHub のイベントからセッションを開始する条件です
+type WebhookTrigger struct {
+	// Label は issue/PR に付けるとセッションを開始するラベルです (空の場合はラベルで開始しません)
+	Label string
+	// Mention は issue の本文やコメントに含めるとセッションを開始する文字列です (空の場合はコメントで開始しません)
+	Mention string
+	// Associations はコメントや issue でセッションを開始できる作成者とリポジトリの関係 (OWNER, MEMBER など) です
+	Associations []string
+}
+
+// ExtensionConfig は goose に渡す MCP 拡張の設定です
+type ExtensionConfig struct {
+	Name    string `mapstructure:"name"`
+	Command string `mapstructure:"command"`
+	// Env は KEY=VALUE 形式の環境変数です。VALUE 内の $VAR は実行時に展開されます
+	Env []string `mapstructure:"env"`
+	// Enabled が未指定の場合は有効として扱います
+	Enabled *bool `mapstructure:"enabled"`
+	// Timeout は拡張のツール呼び出しのタイムアウトです (0 の場合は goose のデフォルト)
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// IsEnabled は拡張が有効かどうかを返します
+func (e ExtensionConfig) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// defaultExtensions はイメージに含まれる MCP 拡張のデフォルト設定です
+var defaultExtensions = []map[string]any{
+	{
+		"name":    "github",
+		"command": "mise exec -- npx -y @modelcontextprotocol/server-github",
+		"env":     []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN"},
+	},
+	{
+		"name":    "memory-bank",
+		"command": "mise exec -- npx -y @allpepper/memory-bank-mcp",
+		"env":     []string{"MEMORY_BANK_ROOT=$HOME/.kommon/memory"},
+	},
+	{
+		"name":    "sequential-thinking",
+		"command": "mise exec -- npx -y @modelcontextprotocol/server-sequential-thinking",
+	},
+}
+
 func NewConfig() (*Config, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.ValidateRequiredValues(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// defaultEnvPassthrough は goose に引き継ぐ goose-connect 自身の環境変数のデフォルトです
+// コンテナの環境変数で goose のプロバイダや API キーを設定している既存の環境が動くよう、すべて引き継ぎます
+var defaultEnvPassthrough = []string{"*"}
+
+// LoadConfig は必須項目の検証を行わずに設定を読み込みます
+// セッションの参照など、git の設定が不要なコマンドから使用します
+func LoadConfig() (*Config, error) {
 	// デフォルト値の設定
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("url", "http://localhost:8080")
 	viper.SetDefault("base_dir", fmt.Sprintf("%s/.goose-connect", os.Getenv("HOME")))
 	viper.SetDefault("git_user", "")
 	viper.SetDefault("git_mail", "")
+	viper.SetDefault("git_signing_key", "")
+	viper.SetDefault("git_signing_format", "ssh")
+	viper.SetDefault("git_identities", map[string]any{})
 	viper.SetDefault("instruction_path", "/etc/goose-connect/instructions.md")
+	viper.SetDefault("output_tail_lines", 200)
+	viper.SetDefault("max_concurrent_sessions", 4)
+	viper.SetDefault("max_queue_size", 100)
+	viper.SetDefault("max_concurrent_sessions_per_repo", 0)
+	viper.SetDefault("max_concurrent_sessions_per_org", 0)
+	viper.SetDefault("session_lock_policy", "wait")
+	viper.SetDefault("shutdown_grace_period", 5*time.Minute)
+	viper.SetDefault("server_read_timeout", 10*time.Second)
+	viper.SetDefault("server_write_timeout", 30*time.Second)
+	viper.SetDefault("task_registry_path", "")
+	viper.SetDefault("task_retention", 24*time.Hour)
+	viper.SetDefault("process_kill_timeout", 10*time.Second)
+	viper.SetDefault("task_timeout", 0)
+	viper.SetDefault("max_attempts", 1)
+	viper.SetDefault("script_template_path", "")
+	viper.SetDefault("resume_policy", "resume")
+	viper.SetDefault("builtins", []string{"developer"})
+	viper.SetDefault("workspace_reset", false)
+	viper.SetDefault("feature_branch_prefix", "")
+	viper.SetDefault("extensions", defaultExtensions)
+	viper.SetDefault("repo_extensions", map[string]any{})
+	viper.SetDefault("env_mode", "process")
+	viper.SetDefault("env_passthrough", defaultEnvPassthrough)
+	viper.SetDefault("github_app_id", 0)
+	viper.SetDefault("github_app_private_key_path", "")
+	viper.SetDefault("github_app_private_key", "")
+	viper.SetDefault("github_url", "https://github.com")
+	viper.SetDefault("status_comment", false)
+	viper.SetDefault("status_excerpt_lines", 20)
+	viper.SetDefault("status_label_queued", "")
+	viper.SetDefault("status_label_running", "goose-running")
+	viper.SetDefault("status_label_succeeded", "")
+	viper.SetDefault("status_label_failed", "")
+	viper.SetDefault("check_run", false)
+	viper.SetDefault("check_run_name", "goose-connect")
+	viper.SetDefault("github_api_url", "")
+	viper.SetDefault("github_upload_url", "")
+	viper.SetDefault("webhook_secret", "")
+	viper.SetDefault("webhook_trigger_label", "goose")
+	viper.SetDefault("webhook_mention", "@goose")
+	viper.SetDefault("webhook_allowed_associations", []string{"OWNER", "MEMBER", "COLLABORATOR"})
+	viper.SetDefault("webhook_provider", "openai")
+	viper.SetDefault("webhook_model", "")
+	viper.SetDefault("webhook_api_key", "")
+	viper.SetDefault("webhook_github_token", "")
+	viper.SetDefault("webhook_internal_addr", "127.0.0.1:8081")
 
 	// 環境変数の設定
 	viper.AutomaticEnv()
@@ -39,10 +172,6 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("設定の解析に失敗しました: %w", err)
 	}
 
-	if err := config.ValidateRequiredValues(); err != nil {
-		return nil, err
-	}
-
 	return config, nil
 }
 
@@ -78,10 +207,261 @@ func (c *Config) GetGitMail() string {
 	return viper.GetString("git_mail")
 }
 
+// GetGitIdentity は組織 org のリポジトリで使うコミットの作成者と署名の設定を返します
+// git_identities に組織ごとの設定があれば、指定された項目で git_user などのデフォルトを上書きします
+func (c *Config) GetGitIdentity(org string) (GitIdentity, error) {
+	identity := GitIdentity{
+		Name:          viper.GetString("git_user"),
+		Email:         viper.GetString("git_mail"),
+		SigningKey:    viper.GetString("git_signing_key"),
+		SigningFormat: viper.GetString("git_signing_format"),
+	}
+	var identities map[string]GitIdentity
+	if err := viper.UnmarshalKey("git_identities", &identities); err != nil {
+		return GitIdentity{}, fmt.Errorf("failed to parse git_identities: %w", err)
+	}
+	if o, ok := identities[strings.ToLower(org)]; ok {
+		if o.Name != "" {
+			identity.Name = o.Name
+		}
+		if o.Email != "" {
+			identity.Email = o.Email
+		}
+		if o.SigningKey != "" {
+			identity.SigningKey = o.SigningKey
+		}
+		if o.SigningFormat != "" {
+			identity.SigningFormat = o.SigningFormat
+		}
+	}
+	return identity, nil
+}
+
 func (c *Config) GetInstructionPath() string {
 	return viper.GetString("instruction_path")
 }
 
+// GetOutputTailLines は Execute の戻り値に含める出力の末尾行数を返します
+func (c *Config) GetOutputTailLines() int {
+	return viper.GetInt("output_tail_lines")
+}
+
+// GetMaxConcurrentSessions は同時に実行するセッション数の上限を返します
+func (c *Config) GetMaxConcurrentSessions() int {
+	return viper.GetInt("max_concurrent_sessions")
+}
+
+// GetMaxQueueSize は実行待ちキューに積めるタスク数の上限を返します
+func (c *Config) GetMaxQueueSize() int {
+	return viper.GetInt("max_queue_size")
+}
+
+// GetMaxConcurrentSessionsPerRepo はリポジトリ単位の同時実行数の上限を返します (0 は無制限)
+func (c *Config) GetMaxConcurrentSessionsPerRepo() int {
+	return viper.GetInt("max_concurrent_sessions_per_repo")
+}
+
+// GetMaxConcurrentSessionsPerOrg は組織単位の同時実行数の上限を返します (0 は無制限)
+func (c *Config) GetMaxConcurrentSessionsPerOrg() int {
+	return viper.GetInt("max_concurrent_sessions_per_org")
+}
+
+// GetSessionLockPolicy は同じセッションが実行中の場合の振る舞い (reject, wait, restart) を返します
+func (c *Config) GetSessionLockPolicy() string {
+	return viper.GetString("session_lock_policy")
+}
+
+// GetShutdownGracePeriod はシャットダウン時に実行中のセッションの終了を待つ時間を返します
+func (c *Config) GetShutdownGracePeriod() time.Duration {
+	return viper.GetDuration("shutdown_grace_period")
+}
+
+// GetServerReadTimeout は HTTP サーバーのリクエスト読み込みのタイムアウトを返します
+func (c *Config) GetServerReadTimeout() time.Duration {
+	return viper.GetDuration("server_read_timeout")
+}
+
+// GetServerWriteTimeout は HTTP サーバーのレスポンス書き込みのタイムアウトを返します
+// タスクは非同期に実行されるため、セッションの実行時間とは関係ありません
+func (c *Config) GetServerWriteTimeout() time.Duration {
+	return viper.GetDuration("server_write_timeout")
+}
+
+// GetTaskRegistryPath はタスクの状態を保存するファイルのパスを返します (空の場合はメモリのみ)
+func (c *Config) GetTaskRegistryPath() string {
+	return viper.GetString("task_registry_path")
+}
+
+// GetTaskRetention は終了したタスクの情報を保持する期間を返します
+func (c *Config) GetTaskRetention() time.Duration {
+	return viper.GetDuration("task_retention")
+}
+
+// GetProcessKillTimeout は goose のプロセスグループに SIGTERM を送ってから SIGKILL を送るまでの猶予を返します
+func (c *Config) GetProcessKillTimeout() time.Duration {
+	return viper.GetDuration("process_kill_timeout")
+}
+
+// GetTaskTimeout は 1 回のタスクで goose を実行できる時間の上限を返します (0 の場合は無制限)
+func (c *Config) GetTaskTimeout() time.Duration {
+	return viper.GetDuration("task_timeout")
+}
+
+// GetMaxAttempts は 1 回のタスクで goose を実行する回数の上限 (失敗時の再開を含む) を返します
+func (c *Config) GetMaxAttempts() int {
+	return viper.GetInt("max_attempts")
+}
+
+// GetScriptTemplatePath は実行スクリプトのテンプレートのパスを返します (空の場合は組み込みのテンプレート)
+func (c *Config) GetScriptTemplatePath() string {
+	return viper.GetString("script_template_path")
+}
+
+// GetResumePolicy は goose の既存セッションの扱い (resume, new) を返します
+func (c *Config) GetResumePolicy() string {
+	return viper.GetString("resume_policy")
+}
+
+// GetWorkspaceReset は実行前に repo の未コミットの変更と追跡されていないファイルを破棄するかどうかを返します
+func (c *Config) GetWorkspaceReset() bool {
+	return viper.GetBool("workspace_reset")
+}
+
+// GetFeatureBranchPrefix は PR のブランチが無い場合に作成するブランチ名の接頭辞を返します
+// 空の場合はブランチを作成せず、リモートのデフォルトブランチのまま実行します
+func (c *Config) GetFeatureBranchPrefix() string {
+	return viper.GetString("feature_branch_prefix")
+}
+
+// GetBuiltins は goose に渡す組み込み拡張の名前を返します
+func (c *Config) GetBuiltins() []string {
+	return viper.GetStringSlice("builtins")
+}
+
+// GetExtensions は全リポジトリ共通の MCP 拡張の設定を返します
+func (c *Config) GetExtensions() ([]ExtensionConfig, error) {
+	var extensions []ExtensionConfig
+	if err := viper.UnmarshalKey("extensions", &extensions); err != nil {
+		return nil, fmt.Errorf("failed to parse extensions: %w", err)
+	}
+	return extensions, nil
+}
+
+// GetRepoExtensions はリポジトリ (org/repo) または組織 (org) ごとの MCP 拡張の上書き設定を返します
+// キーは小文字に正規化されます
+func (c *Config) GetRepoExtensions() (map[string][]ExtensionConfig, error) {
+	var overrides map[string][]ExtensionConfig
+	if err := viper.UnmarshalKey("repo_extensions", &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse repo_extensions: %w", err)
+	}
+	return overrides, nil
+}
+
+// GetEnvMode はセッションの環境変数を goose に渡す方法 (process, file) を返します
+func (c *Config) GetEnvMode() string {
+	return viper.GetString("env_mode")
+}
+
+// GetEnvPassthrough は goose-connect 自身の環境変数のうち goose に引き継ぐ名前を返します
+// 末尾が * の名前は前方一致で比較します
+func (c *Config) GetEnvPassthrough() []string {
+	return viper.GetStringSlice("env_passthrough")
+}
+
+// GetGitHubAppID は GitHub App の ID を返します (0 の場合は App を使わず、リクエストのトークンを使います)
+func (c *Config) GetGitHubAppID() int64 {
+	return viper.GetInt64("github_app_id")
+}
+
+// GetGitHubAppPrivateKey は GitHub App の秘密鍵 (PEM) を返します
+// github_app_private_key_path が設定されていればそのファイルを、なければ github_app_private_key の値を使います
+func (c *Config) GetGitHubAppPrivateKey() ([]byte, error) {
+	if path := viper.GetString("github_app_private_key_path"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read github_app_private_key_path: %w", err)
+		}
+		return key, nil
+	}
+	return []byte(viper.GetString("github_app_private_key")), nil
+}
+
+// GetGitHubURL は既定の GitHub の Web の URL を返します (GitHub Enterprise Server の場合は https://ghe.example.com など)
+func (c *Config) GetGitHubURL() string {
+	return viper.GetString("github_url")
+}
+
+// GetGitHubAPIURL は既定の GitHub の API のベース URL を返します (空の場合は github_url から導出します)
+func (c *Config) GetGitHubAPIURL() string {
+	return viper.GetString("github_api_url")
+}
+
+// GetGitHubUploadURL は既定の GitHub のアップロード API のベース URL を返します (空の場合は github_url から導出します)
+func (c *Config) GetGitHubUploadURL() string {
+	return viper.GetString("github_upload_url")
+}
+
+// GetStatusComment は issue/PR に進捗のコメントを投稿するかどうかを返します
+func (c *Config) GetStatusComment() bool {
+	return viper.GetBool("status_comment")
+}
+
+// GetStatusExcerptLines は進捗のコメントに載せるトランスクリプトの末尾の行数を返します
+func (c *Config) GetStatusExcerptLines() int {
+	return viper.GetInt("status_excerpt_lines")
+}
+
+// GetStatusLabels は状態ごとに issue/PR に付けるラベルを返します
+func (c *Config) GetStatusLabels() StatusLabels {
+	return StatusLabels{
+		Queued:    viper.GetString("status_label_queued"),
+		Running:   viper.GetString("status_label_running"),
+		Succeeded: viper.GetString("status_label_succeeded"),
+		Failed:    viper.GetString("status_label_failed"),
+	}
+}
+
+// GetCheckRun は PR のタスクの状態をチェックランで報告するかどうかを返します
+// チェックランの作成には GitHub App のインストールトークンが必要です
+func (c *Config) GetCheckRun() bool {
+	return viper.GetBool("check_run")
+}
+
+// GetCheckRunName はチェックランの名前を返します
+func (c *Config) GetCheckRunName() string {
+	return viper.GetString("check_run_name")
+}
+
+// GetWebhookSecret は GitHub の Webhook の署名 (X-Hub-Signature-256) を検証する秘密の値を返します
+func (c *Config) GetWebhookSecret() string {
+	return viper.GetString("webhook_secret")
+}
+
+// GetWebhookTrigger は GitHub のイベントからセッションを開始する条件を返します
+func (c *Config) GetWebhookTrigger() WebhookTrigger {
+	return WebhookTrigger{
+		Label:        viper.GetString("webhook_trigger_label"),
+		Mention:      viper.GetString("webhook_mention"),
+		Associations: viper.GetStringSlice("webhook_allowed_associations"),
+	}
+}
+
+// GetWebhookProvider は Webhook から開始するセッションの LLM のプロバイダ、モデル、API キーを返します
+func (c *Config) GetWebhookProvider() (provider, model, apiKey string) {
+	return viper.GetString("webhook_provider"), viper.GetString("webhook_model"), viper.GetString("webhook_api_key")
+}
+
+// GetWebhookGitHubToken は GitHub App を使わない場合に Webhook から開始するセッションが使うトークンを返します
+func (c *Config) GetWebhookGitHubToken() string {
+	return viper.GetString("webhook_github_token")
+}
+
+// GetWebhookInternalAddr は webhook サーバーのタスクの操作とメトリクスのエンドポイントのアドレスを返します
+// 認証がないため、外部から到達できないアドレスを指定します (空の場合は提供しません)
+func (c *Config) GetWebhookInternalAddr() string {
+	return viper.GetString("webhook_internal_addr")
+}
+
 func ValidateRequiredValues() error {
 	cfg, err := NewConfig()
 	if err != nil {
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -204,4 +206,58 @@ func TestConfig_GetInstructionPath(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestConfig_GetExtensions(t *testing.T) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	extensions, err := cfg.GetExtensions()
+	if err != nil {
+		t.Fatalf("GetExtensions failed: %v", err)
+	}
+	var names []string
+	for _, e := range extensions {
+		if !e.IsEnabled() {
+			t.Errorf("default extension %s should be enabled", e.Name)
+		}
+		names = append(names, e.Name)
+	}
+	if len(names) != 3 || names[0] != "github" || names[1] != "memory-bank" || names[2] != "sequential-thinking" {
+		t.Errorf("default extensions = %v", names)
+	}
+	if len(extensions) > 0 && (len(extensions[0].Env) != 1 || extensions[0].Env[0] != "GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN") {
+		t.Errorf("github extension env = %v", extensions[0].Env)
+	}
+}
+
+func TestConfig_GetGitIdentity(t *testing.T) {
+	// viper.Set の値は環境変数より優先されるため、後のテストに残らないよう戻す
+	t.Cleanup(viper.Reset)
+	viper.Set("git_user", "default-bot")
+	viper.Set("git_mail", "bot@example.com")
+	viper.Set("git_identities", map[string]any{
+		"my-org": map[string]any{"email": "bot@my-org.example.com", "signing_key": "/keys/my-org", "signing_format": "openpgp"},
+	})
+
+	cfg := &Config{}
+	tests := []struct {
+		org  string
+		want GitIdentity
+	}{
+		{org: "other", want: GitIdentity{Name: "default-bot", Email: "bot@example.com", SigningFormat: viper.GetString("git_signing_format")}},
+		{org: "My-Org", want: GitIdentity{Name: "default-bot", Email: "bot@my-org.example.com", SigningKey: "/keys/my-org", SigningFormat: "openpgp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.org, func(t *testing.T) {
+			got, err := cfg.GetGitIdentity(tt.org)
+			if err != nil {
+				t.Fatalf("GetGitIdentity failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetGitIdentity(%q) = %+v, want %+v", tt.org, got, tt.want)
+			}
+		})
+	}
+}
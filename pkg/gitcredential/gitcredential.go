@@ -0,0 +1,75 @@
+// Package gitcredential は git の credential helper のプロトコル (key=value 形式) を扱います
+// https://git-scm.com/docs/git-credential#IOFMT
+package gitcredential
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Credential は git と credential helper の間でやり取りする属性です
+type Credential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Read は r から空行または EOF までの属性を読み取ります
+// 未知の属性は無視します
+func Read(r io.Reader) (*Credential, error) {
+	c := &Credential{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential attribute: %q", line)
+		}
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credential: %w", err)
+	}
+	return c, nil
+}
+
+// Write は c の空でない属性を w に書き込みます
+func Write(w io.Writer, c *Credential) error {
+	attrs := []struct{ key, value string }{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"path", c.Path},
+		{"username", c.Username},
+		{"password", c.Password},
+	}
+	for _, a := range attrs {
+		if a.value == "" {
+			continue
+		}
+		if strings.ContainsAny(a.value, "\n\x00") {
+			return fmt.Errorf("credential attribute %s contains a newline or NUL", a.key)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", a.key, a.value); err != nil {
+			return fmt.Errorf("failed to write credential: %w", err)
+		}
+	}
+	return nil
+}
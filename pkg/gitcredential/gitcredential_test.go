@@ -0,0 +1,62 @@
+package gitcredential
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Credential
+		wantErr bool
+	}{
+		{
+			name:  "git credential fill の入力",
+			input: "protocol=https\nhost=github.com\npath=org/repo.git\n\n",
+			want:  Credential{Protocol: "https", Host: "github.com", Path: "org/repo.git"},
+		},
+		{
+			name:  "空行が無く EOF で終わる・未知の属性は無視する",
+			input: "protocol=https\nhost=github.com\nwwwauth[]=Basic realm=\"GitHub\"",
+			want:  Credential{Protocol: "https", Host: "github.com"},
+		},
+		{
+			name:  "空行以降は読まない",
+			input: "host=github.com\n\nhost=example.com\n",
+			want:  Credential{Host: "github.com"},
+		},
+		{
+			name:    "= の無い行",
+			input:   "protocol\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("Read() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, &Credential{Username: "x-access-token", Password: "ghs_token"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got, want := buf.String(), "username=x-access-token\npassword=ghs_token\n"; got != want {
+		t.Errorf("Write() = %q, want %q", got, want)
+	}
+
+	if err := Write(&buf, &Credential{Password: "token\nhost=evil.example.com"}); err == nil {
+		t.Errorf("expected error for value containing a newline")
+	}
+}
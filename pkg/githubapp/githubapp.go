@@ -0,0 +1,206 @@
+// Package githubapp は GitHub App として認証し、リポジトリのインストールトークンを発行・更新します
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/goose-connect/pkg/githubclient"
+)
+
+const (
+	// jwtLifetime は App の JWT の有効期間です (GitHub の上限は 10 分)
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew は GitHub との時刻のずれを許容するため iat を過去にずらす時間です
+	jwtClockSkew = time.Minute
+	// RefreshMargin は有効期限のこの時間前にトークンを更新します
+	RefreshMargin = 5 * time.Minute
+)
+
+// ErrNotInstalled は App が対象のリポジトリにインストールされていない場合のエラーです
+var ErrNotInstalled = errors.New("GitHub App is not installed on the repository")
+
+// App は GitHub App の ID と秘密鍵です
+type App struct {
+	ID  int64
+	key *rsa.PrivateKey
+	// apiURL は GitHub API の URL です (空の場合は https://api.github.com/)
+	apiURL string
+	// now はテストで時刻を差し替えるためのものです
+	now func() time.Time
+}
+
+// New は PEM 形式の秘密鍵 (PKCS#1 または PKCS#8) から App を作成します
+func New(id int64, privateKeyPEM []byte, apiURL string) (*App, error) {
+	if id <= 0 {
+		return nil, fmt.Errorf("GitHub App ID is required")
+	}
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+		}
+		key = k
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+		}
+		rsaKey, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("GitHub App private key must be an RSA key")
+		}
+		key = rsaKey
+	default:
+		return nil, fmt.Errorf("unsupported GitHub App private key type: %s", block.Type)
+	}
+	return &App{ID: id, key: key, apiURL: apiURL, now: time.Now}, nil
+}
+
+// JWT は App として API を呼び出すための RS256 の JWT を返します
+func (a *App) JWT() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(a.ID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+// Token はインストールトークンとその有効期限です
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// InstallationToken は owner/repo にインストールされた App のトークンを、そのリポジトリだけに絞って発行します
+func (a *App) InstallationToken(ctx context.Context, owner, repo string) (*Token, error) {
+	client, err := a.client()
+	if err != nil {
+		return nil, err
+	}
+	installation, resp, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s/%s", ErrNotInstalled, owner, repo)
+		}
+		return nil, fmt.Errorf("failed to find installation for %s/%s: %w", owner, repo, err)
+	}
+	token, _, err := client.Apps.CreateInstallationToken(ctx, installation.GetID(), &github.InstallationTokenOptions{
+		Repositories: []string{repo},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for %s/%s: %w", owner, repo, err)
+	}
+	return &Token{Value: token.GetToken(), ExpiresAt: token.GetExpiresAt().Time}, nil
+}
+
+// client は JWT で認証する GitHub API のクライアントを返します
+func (a *App) client() (*github.Client, error) {
+	client := github.NewClient(&http.Client{Transport: &jwtTransport{app: a, base: &githubclient.Transport{}}})
+	if a.apiURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(a.apiURL, "/") + "/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub API URL: %w", err)
+		}
+		client.BaseURL = u
+	}
+	return client, nil
+}
+
+// jwtTransport はリクエストごとに新しい JWT を Authorization ヘッダに付与します
+type jwtTransport struct {
+	app  *App
+	base http.RoundTripper
+}
+
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.JWT()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// TokenSource は 1 つのリポジトリのインストールトークンをキャッシュし、期限が近づくと更新します
+type TokenSource struct {
+	app   *App
+	owner string
+	repo  string
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// TokenSource は owner/repo のトークンを発行する TokenSource を返します
+func (a *App) TokenSource(owner, repo string) *TokenSource {
+	return &TokenSource{app: a, owner: owner, repo: repo}
+}
+
+// Token は有効なトークンを返します
+// キャッシュしたトークンの有効期限まで RefreshMargin を切っていれば新しく発行します
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && s.app.now().Add(RefreshMargin).Before(s.token.ExpiresAt) {
+		return s.token.Value, nil
+	}
+	token, err := s.app.InstallationToken(ctx, s.owner, s.repo)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	return token.Value, nil
+}
+
+// Refresh はキャッシュの有効期限に関係なく新しいトークンを発行し、以降の Token でも使います
+// 途中で更新できない場所に渡すトークンを、できるだけ長く有効にするために使います
+func (s *TokenSource) Refresh(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.app.InstallationToken(ctx, s.owner, s.repo)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
@@ -0,0 +1,179 @@
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func generateKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verifyJWT は token の署名を検証し、クレームを返します
+func verifyJWT(t *testing.T, key *rsa.PrivateKey, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid JWT: %s", token)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("invalid JWT signature: %v", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Failed to decode claims: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("Failed to parse claims: %v", err)
+	}
+	return claims
+}
+
+func TestNew(t *testing.T) {
+	key, pkcs1 := generateKey(t)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+
+	tests := []struct {
+		name    string
+		id      int64
+		key     []byte
+		wantErr bool
+	}{
+		{name: "PKCS#1", id: 1, key: pkcs1},
+		{name: "PKCS#8", id: 1, key: pkcs8},
+		{name: "ID が無い", id: 0, key: pkcs1, wantErr: true},
+		{name: "PEM ではない", id: 1, key: []byte("not a key"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.id, tt.key, ""); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWT(t *testing.T) {
+	key, keyPEM := generateKey(t)
+	app, err := New(12345, keyPEM, "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	app.now = func() time.Time { return now }
+
+	token, err := app.JWT()
+	if err != nil {
+		t.Fatalf("JWT failed: %v", err)
+	}
+	claims := verifyJWT(t, key, token)
+	if claims["iss"] != "12345" {
+		t.Errorf("iss = %v", claims["iss"])
+	}
+	if iat := int64(claims["iat"].(float64)); iat != now.Add(-jwtClockSkew).Unix() {
+		t.Errorf("iat = %d", iat)
+	}
+	if exp := int64(claims["exp"].(float64)); exp-now.Unix() > int64((10 * time.Minute).Seconds()) {
+		t.Errorf("exp exceeds the 10 minute limit: %d", exp)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	key, keyPEM := generateKey(t)
+	var issued atomic.Int32
+	now := time.Now()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/my-org/my-repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(t, key, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		fmt.Fprint(w, `{"id": 42}`)
+	})
+	mux.HandleFunc("GET /repos/my-org/other/installation", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Repositories) != 1 || body.Repositories[0] != "my-repo" {
+			t.Errorf("token must be scoped to the repository: %+v (%v)", body, err)
+		}
+		n := issued.Add(1)
+		fmt.Fprintf(w, `{"token": "ghs_token%d", "expires_at": %q}`, n, now.Add(time.Hour).Format(time.RFC3339))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	app, err := New(1, keyPEM, srv.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	clock := now
+	app.now = func() time.Time { return clock }
+	src := app.TokenSource("my-org", "my-repo")
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		refresh bool
+		want    string
+	}{
+		{name: "初回は発行する", want: "ghs_token1"},
+		{name: "有効期限まで余裕があればキャッシュを使う", advance: 30 * time.Minute, want: "ghs_token1"},
+		{name: "Refresh は有効期限に関係なく発行する", refresh: true, want: "ghs_token2"},
+		{name: "Refresh したトークンをキャッシュする", advance: 10 * time.Minute, want: "ghs_token2"},
+		{name: "有効期限が近づくと更新する", advance: 16 * time.Minute, want: "ghs_token3"},
+	}
+	for _, step := range steps {
+		clock = clock.Add(step.advance)
+		var got string
+		if step.refresh {
+			token, err := src.Refresh(context.Background())
+			if err != nil {
+				t.Fatalf("%s: Refresh failed: %v", step.name, err)
+			}
+			got = token.Value
+		} else {
+			if got, err = src.Token(context.Background()); err != nil {
+				t.Fatalf("%s: Token failed: %v", step.name, err)
+			}
+		}
+		if got != step.want {
+			t.Errorf("%s: got %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if _, err := app.TokenSource("my-org", "other").Token(context.Background()); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("expected ErrNotInstalled, got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Package githubclient は GitHub API の一時的な失敗とレート制限を再試行する HTTP クライアントを提供します
+//
+// 429、セカンダリレート制限の 403 と、冪等なリクエストの 5xx とネットワークのエラーを指数バックオフで再試行し、
+// Retry-After と X-RateLimit-Reset があればその時刻まで待ちます
+// レート制限の残りは expvar の github_api に公開します
+package githubclient
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 既定値です
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultMaxWait を超える Retry-After やレート制限のリセットは待たずに失敗を返します
+	DefaultMaxWait = time.Minute
+	// DefaultTimeout は再試行を含めた 1 回の API 呼び出しの期限です (コンテキストに期限がない場合)
+	DefaultTimeout = 2 * time.Minute
+)
+
+// Metrics は GitHub API の呼び出しの統計です
+// rate_limit_remaining.<resource> などはレスポンスのヘッダの最新の値です
+var Metrics = expvar.NewMap("github_api")
+
+// Transport は GitHub API のリクエストを再試行する http.RoundTripper です
+// ゼロ値のフィールドには既定値を使います
+type Transport struct {
+	// Base は実際にリクエストを送る RoundTripper です (nil の場合は http.DefaultTransport)
+	Base       http.RoundTripper
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	MaxWait    time.Duration
+	Timeout    time.Duration
+
+	// sleep はテストで待ち時間を記録するために置き換えます
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewHTTPClient は Transport で再試行する http.Client を返します
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: &Transport{}}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, orDefault(t.Timeout, DefaultTimeout))
+		req = req.WithContext(ctx)
+	}
+	resp, err := t.roundTrip(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 期限はレスポンスの本文を読み終えるまで有効にする
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *Transport) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	maxRetries := t.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	// 本文を読み直せないリクエストは再試行しない
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			Metrics.Add("retries", 1)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req = req.Clone(ctx)
+				req.Body = body
+			}
+		}
+		Metrics.Add("requests", 1)
+		resp, err := base.RoundTrip(req)
+		if err == nil {
+			recordRateLimit(resp.Header)
+		}
+		wait, retry := t.retryAfter(req.Method, resp, err, attempt)
+		if !retry || attempt >= maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			// 接続を再利用できるよう本文を読み捨てる
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if err := t.wait(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter はレスポンスを再試行するかどうかと、再試行までの待ち時間を返します
+// POST などの冪等でないリクエストは、サーバーが処理した後に失敗した可能性があるため、
+// 処理されなかったことが確かなレート制限の場合だけ再試行します
+func (t *Transport) retryAfter(method string, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	backoff := t.backoff(attempt)
+	idempotent := isIdempotent(method)
+	if err != nil {
+		if !idempotent {
+			return 0, false
+		}
+		// コンテキストのキャンセルや期限切れは再試行しない
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		return backoff, true
+	}
+	var wait time.Duration
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		if d, ok := parseRetryAfter(resp.Header); ok {
+			wait = d
+		} else if d, ok := parseRateLimitReset(resp.Header); ok {
+			wait = d
+		} else if resp.StatusCode == http.StatusForbidden {
+			// 権限不足の 403 は再試行しても成功しない
+			return 0, false
+		} else {
+			wait = backoff
+		}
+		Metrics.Add("rate_limited", 1)
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if !idempotent {
+			return 0, false
+		}
+		wait = backoff
+		if d, ok := parseRetryAfter(resp.Header); ok {
+			wait = d
+		}
+	default:
+		return 0, false
+	}
+	if wait > orDefault(t.MaxWait, DefaultMaxWait) {
+		return 0, false
+	}
+	return wait, true
+}
+
+// isIdempotent は同じリクエストを繰り返しても結果が変わらないメソッドかどうかを返します
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff は attempt 回目の失敗の後の、ジッター付きの指数バックオフの待ち時間を返します
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := orDefault(t.MinBackoff, DefaultMinBackoff) << attempt
+	if limit := orDefault(t.MaxBackoff, DefaultMaxBackoff); d <= 0 || d > limit {
+		d = limit
+	}
+	// 同時に失敗したリクエストが一斉に再試行しないよう、半分から全体の間でばらつかせる
+	return d/2 + rand.N(d/2+1)
+}
+
+func (t *Transport) wait(ctx context.Context, d time.Duration) error {
+	if t.sleep != nil {
+		return t.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// parseRetryAfter は秒数または HTTP 日付の Retry-After を待ち時間に変換します
+func parseRetryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// parseRateLimitReset はレート制限を使い切った場合に、X-RateLimit-Reset までの待ち時間を返します
+func parseRateLimitReset(h http.Header) (time.Duration, bool) {
+	if h.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	// 時計のずれを見込んで 1 秒余分に待つ
+	return max(time.Until(time.Unix(reset, 0)), 0) + time.Second, true
+}
+
+// recordRateLimit はレート制限のヘッダを Metrics に記録します
+func recordRateLimit(h http.Header) {
+	resource := h.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	for header, key := range map[string]string{
+		"X-RateLimit-Limit":     "rate_limit_limit.",
+		"X-RateLimit-Remaining": "rate_limit_remaining.",
+		"X-RateLimit-Reset":     "rate_limit_reset.",
+	} {
+		if n, err := strconv.ParseInt(h.Get(header), 10, 64); err == nil {
+			v := new(expvar.Int)
+			v.Set(n)
+			Metrics.Set(key+resource, v)
+		}
+	}
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+// cancelBody は本文を閉じたときにリクエストの期限を解放します
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,206 @@
+package githubclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransportRetry(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(10*time.Second).Unix(), 10)
+	testCases := []struct {
+		name   string
+		method string
+		// responses は試行ごとのステータスとヘッダです。最後の要素を繰り返します
+		responses   []func(w http.ResponseWriter)
+		wantStatus  int
+		wantAttempt int
+		// wantWaits は待ち時間の下限です
+		wantWaits []time.Duration
+	}{
+		{
+			name:   "冪等なリクエストは 5xx の後に成功する",
+			method: http.MethodPut,
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusBadGateway, nil),
+				status(http.StatusOK, nil),
+			},
+			wantStatus:  http.StatusOK,
+			wantAttempt: 2,
+			wantWaits:   []time.Duration{5 * time.Millisecond},
+		},
+		{
+			name: "Retry-After の秒数だけ待つ",
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusForbidden, map[string]string{"Retry-After": "7"}),
+				status(http.StatusOK, nil),
+			},
+			wantStatus:  http.StatusOK,
+			wantAttempt: 2,
+			wantWaits:   []time.Duration{7 * time.Second},
+		},
+		{
+			name: "レート制限を使い切ったらリセットまで待つ",
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}),
+				status(http.StatusOK, nil),
+			},
+			wantStatus:  http.StatusOK,
+			wantAttempt: 2,
+			wantWaits:   []time.Duration{8 * time.Second},
+		},
+		{
+			name: "POST の 5xx は処理済みの可能性があるため再試行しない",
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusBadGateway, nil),
+				status(http.StatusOK, nil),
+			},
+			wantStatus:  http.StatusBadGateway,
+			wantAttempt: 1,
+		},
+		{
+			name: "権限不足の 403 は再試行しない",
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4999"}),
+			},
+			wantStatus:  http.StatusForbidden,
+			wantAttempt: 1,
+		},
+		{
+			name: "MaxWait を超える待ち時間は再試行しない",
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusTooManyRequests, map[string]string{"Retry-After": "3600"}),
+			},
+			wantStatus:  http.StatusTooManyRequests,
+			wantAttempt: 1,
+		},
+		{
+			name:   "再試行の回数を使い切ったら最後のレスポンスを返す",
+			method: http.MethodDelete,
+			responses: []func(w http.ResponseWriter){
+				status(http.StatusServiceUnavailable, nil),
+			},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantAttempt: 3,
+			wantWaits:   []time.Duration{5 * time.Millisecond, 10 * time.Millisecond},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var attempts int
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				i := min(attempts, len(tc.responses)-1)
+				attempts++
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+				tc.responses[i](w)
+			}))
+			defer srv.Close()
+
+			var waits []time.Duration
+			tr := &Transport{
+				Base:       srv.Client().Transport,
+				MaxRetries: 2,
+				MinBackoff: 10 * time.Millisecond,
+				sleep: func(ctx context.Context, d time.Duration) error {
+					waits = append(waits, d)
+					return nil
+				},
+			}
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, srv.URL+"/repos/org/repo/issues/7/labels", strings.NewReader(`["goose-running"]`))
+			if err != nil {
+				t.Fatalf("NewRequest failed: %v", err)
+			}
+			resp, err := (&http.Client{Transport: tr}).Do(req)
+			if err != nil {
+				t.Fatalf("Do failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if attempts != tc.wantAttempt {
+				t.Errorf("attempts = %d, want %d", attempts, tc.wantAttempt)
+			}
+			for _, body := range bodies {
+				if body != `["goose-running"]` {
+					t.Errorf("request body is not replayed: %q", body)
+				}
+			}
+			if len(waits) != len(tc.wantWaits) {
+				t.Fatalf("waits = %v, want %v", waits, tc.wantWaits)
+			}
+			for i, want := range tc.wantWaits {
+				if waits[i] < want {
+					t.Errorf("waits[%d] = %s, want at least %s", i, waits[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	tr := &Transport{Base: srv.Client().Transport, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err == nil {
+		t.Fatalf("request must fail after the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request is retried after the deadline: %s", elapsed)
+	}
+}
+
+func TestRecordRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Header().Set("X-RateLimit-Reset", "1767322800")
+		w.Header().Set("X-RateLimit-Resource", "search")
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: &Transport{Base: srv.Client().Transport}}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	for key, want := range map[string]string{
+		"rate_limit_limit.search":     "5000",
+		"rate_limit_remaining.search": "4321",
+		"rate_limit_reset.search":     "1767322800",
+	} {
+		if got := Metrics.Get(key); got == nil || got.String() != want {
+			t.Errorf("%s = %v, want %s", key, got, want)
+		}
+	}
+}
+
+func status(code int, headers map[string]string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(code)
+	}
+}
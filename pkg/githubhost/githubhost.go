@@ -0,0 +1,142 @@
+// Package githubhost は github.com と GitHub Enterprise Server の
+// Web のホスト、API のベース URL、アップロード用の URL を対応付けます
+package githubhost
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const (
+	dotComWeb    = "https://github.com/"
+	dotComAPI    = "https://api.github.com/"
+	dotComUpload = "https://uploads.github.com/"
+)
+
+// Host は 1 つの GitHub (github.com または GitHub Enterprise Server) の URL です
+// いずれの URL も末尾が / で終わります。ゼロ値は github.com を表します
+type Host struct {
+	// WebURL は clone やイベントの URL のベースです (https://github.com/, https://ghe.example.com/)
+	WebURL *url.URL
+	// APIURL は REST API のベースです (https://api.github.com/, https://ghe.example.com/api/v3/)
+	APIURL *url.URL
+	// UploadURL はアップロード API のベースです (https://uploads.github.com/, https://ghe.example.com/api/uploads/)
+	UploadURL *url.URL
+}
+
+// DotCom は github.com の Host です
+var DotCom = Host{
+	WebURL:    mustParse(dotComWeb),
+	APIURL:    mustParse(dotComAPI),
+	UploadURL: mustParse(dotComUpload),
+}
+
+// New は Web のホストの URL から Host を作成します
+// apiURL, uploadURL が空の場合は webURL から導出します
+func New(webURL, apiURL, uploadURL string) (Host, error) {
+	web, err := parseBase(webURL)
+	if err != nil {
+		return Host{}, fmt.Errorf("invalid GitHub URL: %w", err)
+	}
+	h := Host{WebURL: web}
+	if h.isDotCom() {
+		h.APIURL, h.UploadURL = DotCom.APIURL, DotCom.UploadURL
+	} else {
+		h.APIURL = web.JoinPath("api", "v3")
+		h.UploadURL = web.JoinPath("api", "uploads")
+		h.APIURL.Path += "/"
+		h.UploadURL.Path += "/"
+	}
+	if apiURL != "" {
+		if h.APIURL, err = parseBase(apiURL); err != nil {
+			return Host{}, fmt.Errorf("invalid GitHub API URL: %w", err)
+		}
+	}
+	if uploadURL != "" {
+		if h.UploadURL, err = parseBase(uploadURL); err != nil {
+			return Host{}, fmt.Errorf("invalid GitHub upload URL: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// FromAPIURL は API のベース URL から Host を作成します
+// api.github.com は github.com に、<host>/api/v3 は <host> に対応付けます
+func FromAPIURL(apiURL string) (Host, error) {
+	api, err := parseBase(apiURL)
+	if err != nil {
+		return Host{}, fmt.Errorf("invalid GitHub API URL: %w", err)
+	}
+	if strings.EqualFold(api.Host, DotCom.APIURL.Host) {
+		return DotCom, nil
+	}
+	web := *api
+	web.Path = strings.TrimSuffix(strings.TrimSuffix(api.Path, "/"), "/api/v3") + "/"
+	return New(web.String(), api.String(), "")
+}
+
+// Hostname は Web のホスト名 (ポートを含む) を返します
+func (h Host) Hostname() string {
+	return h.orDotCom().WebURL.Host
+}
+
+// RepoURL は repo (org/repo) の Web の URL を返します
+func (h Host) RepoURL(repo string) string {
+	return h.orDotCom().WebURL.JoinPath(repo).String()
+}
+
+// IsEnterprise は GitHub Enterprise Server かどうかを返します
+func (h Host) IsEnterprise() bool {
+	return !h.orDotCom().isDotCom()
+}
+
+func (h Host) orDotCom() Host {
+	if h.WebURL == nil {
+		return DotCom
+	}
+	return h
+}
+
+func (h Host) isDotCom() bool {
+	return strings.EqualFold(h.WebURL.Host, DotCom.WebURL.Host)
+}
+
+// NewClient は token で認証する h の API のクライアントを返します
+// httpClient が nil の場合は http.DefaultClient を使います
+func (h Host) NewClient(httpClient *http.Client, token string) *github.Client {
+	h = h.orDotCom()
+	client := github.NewClient(httpClient)
+	if token != "" {
+		client = client.WithAuthToken(token)
+	}
+	client.BaseURL = h.APIURL
+	client.UploadURL = h.UploadURL
+	return client
+}
+
+// parseBase は末尾が / の絶対 URL として s を解析します
+func parseBase(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", s)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+func mustParse(s string) *url.URL {
+	u, err := parseBase(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
@@ -0,0 +1,123 @@
+package githubhost
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name                         string
+		webURL, apiURL, uploadURL    string
+		wantWeb, wantAPI, wantUpload string
+		wantEnterprise, wantErr      bool
+	}{
+		{
+			name:       "github.com",
+			webURL:     "https://github.com",
+			wantWeb:    "https://github.com/",
+			wantAPI:    "https://api.github.com/",
+			wantUpload: "https://uploads.github.com/",
+		},
+		{
+			name:           "GitHub Enterprise Server は /api/v3/ を導出する",
+			webURL:         "https://ghe.example.com",
+			wantWeb:        "https://ghe.example.com/",
+			wantAPI:        "https://ghe.example.com/api/v3/",
+			wantUpload:     "https://ghe.example.com/api/uploads/",
+			wantEnterprise: true,
+		},
+		{
+			name:           "API の URL の上書き",
+			webURL:         "https://ghe.example.com/",
+			apiURL:         "https://api.ghe.example.com",
+			uploadURL:      "https://uploads.ghe.example.com",
+			wantWeb:        "https://ghe.example.com/",
+			wantAPI:        "https://api.ghe.example.com/",
+			wantUpload:     "https://uploads.ghe.example.com/",
+			wantEnterprise: true,
+		},
+		{
+			name:    "相対 URL",
+			webURL:  "ghe.example.com",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := New(tc.webURL, tc.apiURL, tc.uploadURL)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if h.WebURL.String() != tc.wantWeb || h.APIURL.String() != tc.wantAPI || h.UploadURL.String() != tc.wantUpload {
+				t.Errorf("got web=%s api=%s upload=%s", h.WebURL, h.APIURL, h.UploadURL)
+			}
+			if h.IsEnterprise() != tc.wantEnterprise {
+				t.Errorf("IsEnterprise() = %t", h.IsEnterprise())
+			}
+		})
+	}
+}
+
+func TestFromAPIURL(t *testing.T) {
+	testCases := []struct {
+		name, apiURL, wantWeb, wantAPI string
+	}{
+		{name: "api.github.com", apiURL: "https://api.github.com", wantWeb: "https://github.com/", wantAPI: "https://api.github.com/"},
+		{name: "GitHub Enterprise Server", apiURL: "https://ghe.example.com/api/v3/", wantWeb: "https://ghe.example.com/", wantAPI: "https://ghe.example.com/api/v3/"},
+		{name: "ポート付き", apiURL: "http://127.0.0.1:8080/api/v3", wantWeb: "http://127.0.0.1:8080/", wantAPI: "http://127.0.0.1:8080/api/v3/"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := FromAPIURL(tc.apiURL)
+			if err != nil {
+				t.Fatalf("FromAPIURL failed: %v", err)
+			}
+			if h.WebURL.String() != tc.wantWeb || h.APIURL.String() != tc.wantAPI {
+				t.Errorf("got web=%s api=%s", h.WebURL, h.APIURL)
+			}
+		})
+	}
+}
+
+func TestHostZeroValue(t *testing.T) {
+	var h Host
+	if h.Hostname() != "github.com" || h.IsEnterprise() {
+		t.Errorf("zero Host must be github.com: %s", h.Hostname())
+	}
+	if got := h.RepoURL("org/repo"); got != "https://github.com/org/repo" {
+		t.Errorf("RepoURL() = %s", got)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"full_name":"org/repo"}`))
+	}))
+	defer srv.Close()
+
+	h, err := New(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got := h.RepoURL("org/repo"); got != srv.URL+"/org/repo" {
+		t.Errorf("RepoURL() = %s", got)
+	}
+	if _, _, err := h.NewClient(srv.Client(), "ghs_token").Repositories.Get(context.Background(), "org", "repo"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if gotPath != "/api/v3/repos/org/repo" || gotAuth != "Bearer ghs_token" {
+		t.Errorf("request path=%s auth=%s", gotPath, gotAuth)
+	}
+}
@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+)
+
+// ProviderInfo.Env でタスクごとに実行予算を上書きするためのキーです
+const (
+	TaskTimeoutEnvKey = "GOOSE_CONNECT_TASK_TIMEOUT"
+	MaxAttemptsEnvKey = "GOOSE_CONNECT_MAX_ATTEMPTS"
+)
+
+// attemptsExhaustedExitCode は実行スクリプトが max_attempts 回失敗したときに返す終了コードです
+const attemptsExhaustedExitCode = 75
+
+var (
+	// ErrBudgetExhausted はタスクが実行予算 (実行時間・試行回数) を使い切った場合のエラーです
+	ErrBudgetExhausted = errors.New("task budget exhausted")
+	// ErrTaskTimeout は task_timeout (GitHub App の場合はトークンの有効期限も) を超えてタスクが打ち切られた場合のエラーです
+	ErrTaskTimeout = fmt.Errorf("%w: task timed out", ErrBudgetExhausted)
+	// ErrAttemptsExhausted は goose の実行が max_attempts 回失敗した場合のエラーです
+	ErrAttemptsExhausted = fmt.Errorf("%w: max attempts reached", ErrBudgetExhausted)
+)
+
+// Budget は 1 回のタスクに許される実行時間と goose の試行回数です
+type Budget struct {
+	// Timeout が 0 の場合は実行時間を制限しません
+	Timeout     time.Duration
+	MaxAttempts int
+}
+
+// ResolveBudget は設定値を基に、provider の環境変数による上書きを反映した実行予算を返します
+func ResolveBudget(cfg *config.Config, provider agent.Provider) (Budget, error) {
+	b := Budget{
+		Timeout:     cfg.GetTaskTimeout(),
+		MaxAttempts: cfg.GetMaxAttempts(),
+	}
+	var env map[string]string
+	if provider != nil {
+		env = provider.GetEnv()
+	}
+	if v, ok := env[TaskTimeoutEnvKey]; ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return Budget{}, fmt.Errorf("invalid %s: %q", TaskTimeoutEnvKey, v)
+		}
+		b.Timeout = d
+	}
+	if v, ok := env[MaxAttemptsEnvKey]; ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Budget{}, fmt.Errorf("invalid %s: %q", MaxAttemptsEnvKey, v)
+		}
+		b.MaxAttempts = n
+	}
+	if b.Timeout < 0 {
+		return Budget{}, fmt.Errorf("task timeout must not be negative: %s", b.Timeout)
+	}
+	if b.MaxAttempts < 1 {
+		return Budget{}, fmt.Errorf("max attempts must be at least 1: %d", b.MaxAttempts)
+	}
+	return b, nil
+}
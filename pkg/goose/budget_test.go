@@ -0,0 +1,81 @@
+package goose
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestResolveBudget(t *testing.T) {
+	viper.Set("task_timeout", "30m")
+	viper.Set("max_attempts", 2)
+	defer viper.Set("task_timeout", 0)
+	defer viper.Set("max_attempts", 1)
+
+	testCases := []struct {
+		name        string
+		env         map[string]string
+		expected    Budget
+		expectError bool
+	}{
+		{
+			name:     "設定値を使用",
+			env:      nil,
+			expected: Budget{Timeout: 30 * time.Minute, MaxAttempts: 2},
+		},
+		{
+			name:     "リクエストの環境変数で上書き",
+			env:      map[string]string{TaskTimeoutEnvKey: "5m", MaxAttemptsEnvKey: "3"},
+			expected: Budget{Timeout: 5 * time.Minute, MaxAttempts: 3},
+		},
+		{
+			name:     "タイムアウトを 0 にすると無制限",
+			env:      map[string]string{TaskTimeoutEnvKey: "0s"},
+			expected: Budget{Timeout: 0, MaxAttempts: 2},
+		},
+		{
+			name:        "不正なタイムアウト",
+			env:         map[string]string{TaskTimeoutEnvKey: "forever"},
+			expectError: true,
+		},
+		{
+			name:        "試行回数が 0",
+			env:         map[string]string{MaxAttemptsEnvKey: "0"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &agent.NoopProvider{ProviderName: "openai", Env: tc.env}
+			budget, err := ResolveBudget(&config.Config{}, provider)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", budget)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBudget failed: %v", err)
+			}
+			if budget != tc.expected {
+				t.Errorf("budget = %+v, expected %+v", budget, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBudgetErrors(t *testing.T) {
+	for _, err := range []error{ErrTaskTimeout, ErrAttemptsExhausted} {
+		if !errors.Is(err, ErrBudgetExhausted) {
+			t.Errorf("%v does not wrap ErrBudgetExhausted", err)
+		}
+	}
+	if errors.Is(ErrTaskTimeout, ErrAttemptsExhausted) {
+		t.Errorf("ErrTaskTimeout must be distinct from ErrAttemptsExhausted")
+	}
+}
@@ -0,0 +1,181 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// チェックランの状態です
+const (
+	checkStatusQueued     = "queued"
+	checkStatusInProgress = "in_progress"
+	checkStatusCompleted  = "completed"
+)
+
+const (
+	// defaultProgressInterval はチェックランに実行中の出力を反映する既定の最短の間隔です
+	defaultProgressInterval = 30 * time.Second
+	// progressLines はチェックランに反映する出力の末尾の行数です
+	progressLines = 20
+	// maxProgressBytes はチェックランに反映する出力の上限です (GitHub の summary の上限は 65535 文字)
+	maxProgressBytes = 60000
+)
+
+func (r *StatusReporter) progressInterval() time.Duration {
+	if r.ProgressInterval > 0 {
+		return r.ProgressInterval
+	}
+	return defaultProgressInterval
+}
+
+// OnOutput は PR のタスクの出力の末尾を保持し、ProgressInterval ごとにチェックランへ反映します
+// goose の出力を止めないよう、チェックランの更新は別の goroutine で行います
+func (r *StatusReporter) OnOutput(task *TaskInfo, line OutputLine) {
+	if !r.Checks || task.Request.GetGithub().GetPrNumber() <= 0 {
+		return
+	}
+	rep := r.report(task.Request, false)
+	if rep == nil {
+		return
+	}
+	rep.outMu.Lock()
+	defer rep.outMu.Unlock()
+	rep.outTail = append(rep.outTail, line.Text)
+	if len(rep.outTail) > progressLines {
+		rep.outTail = append([]string(nil), rep.outTail[len(rep.outTail)-progressLines:]...)
+	}
+	now := r.timeNow()
+	if rep.progressing || now.Sub(rep.lastProgress) < r.progressInterval() {
+		return
+	}
+	rep.progressing = true
+	rep.lastProgress = now
+	go r.publishProgress(task, rep, strings.Join(rep.outTail, "\n"))
+}
+
+// publishProgress は実行中のチェックランの summary に出力の末尾 (text) を載せます
+// 出力は RedactSink で秘密情報を取り除いた後のものです
+func (r *StatusReporter) publishProgress(task *TaskInfo, rep *statusReport, text string) {
+	defer func() {
+		rep.outMu.Lock()
+		rep.progressing = false
+		rep.outMu.Unlock()
+	}()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	// 報告を終えたタスクのチェックランは完了の内容のまま残す
+	if rep.status != TaskStatusRunning {
+		return
+	}
+	if len(text) > maxProgressBytes {
+		text = strings.ToValidUTF8(text[len(text)-maxProgressBytes:], "")
+	}
+	ctx := context.Background()
+	msg := task.Request
+	err := func() error {
+		num, err := prOrIssueNumber(msg.GetGithub())
+		if err != nil {
+			return err
+		}
+		client, err := task.GitHub(ctx)
+		if err != nil {
+			return err
+		}
+		owner, repo := splitRepo(msg.GetGithub().GetRepo())
+		summary := "\n" + codeBlock(fmt.Sprintf("出力の末尾 %d 行", progressLines), text)
+		return r.publishCheck(ctx, client, owner, repo, num, msg, rep, summary)
+	}()
+	if err != nil {
+		log.Printf("Error reporting task progress: %v", err)
+	}
+}
+
+// publishCheck は PR の head のコミットのチェックランを作成または更新します
+// head は最初の報告時点のコミットで、セッション中に push されたコミットには付け替えません
+func (r *StatusReporter) publishCheck(ctx context.Context, client *github.Client, owner, repo string, num int, msg *proto.ExecuteTaskRequest, rep *statusReport, summary string) error {
+	if rep.headSHA == "" {
+		pr, _, err := client.PullRequests.Get(ctx, owner, repo, num)
+		if err != nil {
+			return fmt.Errorf("failed to get pull request head: %w", err)
+		}
+		rep.headSHA = pr.GetHead().GetSHA()
+	}
+	status, conclusion := checkState(rep)
+	output := &github.CheckRunOutput{
+		Title:   github.String(statusTitles[rep.status]),
+		Summary: github.String(r.details(msg, rep) + summary),
+	}
+	var startedAt, completedAt *github.Timestamp
+	if !rep.startedAt.IsZero() {
+		startedAt = &github.Timestamp{Time: rep.startedAt}
+	}
+	if status == checkStatusCompleted {
+		completedAt = &github.Timestamp{Time: r.timeNow()}
+	}
+
+	if rep.checkRunID == 0 {
+		check, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+			Name:        r.checkName(),
+			HeadSHA:     rep.headSHA,
+			ExternalID:  github.String(msg.GetSessionId()),
+			Status:      github.String(status),
+			Conclusion:  conclusion,
+			StartedAt:   startedAt,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create check run: %w", err)
+		}
+		rep.checkRunID = check.GetID()
+		return nil
+	}
+	_, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, rep.checkRunID, github.UpdateCheckRunOptions{
+		Name:        r.checkName(),
+		Status:      github.String(status),
+		Conclusion:  conclusion,
+		CompletedAt: completedAt,
+		Output:      output,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update check run: %w", err)
+	}
+	return nil
+}
+
+func (r *StatusReporter) checkName() string {
+	if r.CheckName != "" {
+		return r.CheckName
+	}
+	return "goose-connect"
+}
+
+// checkState はタスクの状態に対応するチェックランの status と conclusion を返します
+func checkState(rep *statusReport) (string, *string) {
+	switch rep.status {
+	case TaskStatusQueued:
+		return checkStatusQueued, nil
+	case TaskStatusRunning:
+		return checkStatusInProgress, nil
+	}
+	conclusion := "success"
+	switch {
+	case rep.run != nil && rep.run.Status == session.RunStatusTimedOut, errors.Is(rep.err, ErrTaskTimeout):
+		conclusion = "timed_out"
+	// 開始せずに終わったタスクは、キューにある間にキャンセルされたもの
+	case rep.run != nil && rep.run.Status == session.RunStatusCancelled, errors.Is(rep.err, ErrInterrupted),
+		rep.status == TaskStatusFailed && rep.startedAt.IsZero():
+		conclusion = "cancelled"
+	case rep.status == TaskStatusFailed:
+		conclusion = "failure"
+	}
+	return checkStatusCompleted, github.String(conclusion)
+}
@@ -0,0 +1,195 @@
+package goose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// fakeCheckRuns はチェックランの作成と更新のリクエストを記録する httptest サーバーです
+type fakeCheckRuns struct {
+	mu     sync.Mutex
+	checks []map[string]any
+}
+
+func (f *fakeCheckRuns) recorded() []map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]any(nil), f.checks...)
+}
+
+func newFakeCheckRuns(t *testing.T) (*fakeCheckRuns, *github.Client) {
+	t.Helper()
+	f := &fakeCheckRuns{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/org/repo/pulls/8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"number":8,"head":{"sha":"abc123"}}`))
+	})
+	record := func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		body["method"] = r.Method + " " + r.URL.Path
+		f.mu.Lock()
+		f.checks = append(f.checks, body)
+		f.mu.Unlock()
+		_, _ = w.Write([]byte(`{"id":55}`))
+	}
+	mux.HandleFunc("POST /api/v3/repos/org/repo/check-runs", record)
+	mux.HandleFunc("PATCH /api/v3/repos/org/repo/check-runs/55", record)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	host, err := githubhost.New(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return f, host.NewClient(srv.Client(), "ghs_token")
+}
+
+func TestStatusReporterCheckRun(t *testing.T) {
+	fake, client := newFakeCheckRuns(t)
+
+	testCases := []struct {
+		name           string
+		execErr        error
+		runStatus      session.RunStatus
+		wantConclusion string
+	}{
+		{name: "成功", runStatus: session.RunStatusSucceeded, wantConclusion: "success"},
+		{name: "失敗", execErr: errors.New("exit status 1"), runStatus: session.RunStatusFailed, wantConclusion: "failure"},
+		{name: "タイムアウト", execErr: ErrTaskTimeout, runStatus: session.RunStatusTimedOut, wantConclusion: "timed_out"},
+		{name: "シャットダウン", execErr: ErrInterrupted, wantConclusion: "cancelled"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.checks = nil
+			fake.mu.Unlock()
+			r := &StatusReporter{Checks: true, CheckName: "goose"}
+			msg := &proto.ExecuteTaskRequest{
+				SessionId: "org-repo-8",
+				Provider:  &proto.ProviderInfo{ProviderName: "openai", ModelName: "gpt-4o"},
+				Github:    &proto.GitHubInfo{ApiToken: "ghs_token", Repo: "org/repo", PrNumber: 8},
+			}
+			task := &TaskInfo{Request: msg, client: func(context.Context) (*github.Client, error) { return client, nil }}
+			if err := r.OnStart(context.Background(), task); err != nil {
+				t.Fatalf("OnStart failed: %v", err)
+			}
+			var run *session.Run
+			if tc.runStatus != "" {
+				run = &session.Run{Number: 1, Status: tc.runStatus}
+			}
+			if err := r.OnFinally(context.Background(), task, &TaskResult{Err: tc.execErr, Run: run}); err != nil {
+				t.Fatalf("OnFinally failed: %v", err)
+			}
+
+			checks := fake.recorded()
+			if len(checks) != 2 {
+				t.Fatalf("expected create and update, got %v", checks)
+			}
+			created, completed := checks[0], checks[1]
+			if created["method"] != "POST /api/v3/repos/org/repo/check-runs" || created["head_sha"] != "abc123" ||
+				created["name"] != "goose" || created["status"] != "in_progress" || created["external_id"] != "org-repo-8" {
+				t.Errorf("unexpected created check run: %v", created)
+			}
+			if completed["method"] != "PATCH /api/v3/repos/org/repo/check-runs/55" || completed["status"] != "completed" ||
+				completed["conclusion"] != tc.wantConclusion || completed["completed_at"] == nil {
+				t.Errorf("unexpected completed check run: %v", completed)
+			}
+			output, _ := completed["output"].(map[string]any)
+			if summary, _ := output["summary"].(string); !strings.Contains(summary, "`org-repo-8`") {
+				t.Errorf("summary does not describe the session: %v", output)
+			}
+		})
+	}
+}
+
+// TestStatusReporterCheckRunProgress は実行中の出力の末尾が ProgressInterval ごとにチェックランへ反映されることを確認します
+func TestStatusReporterCheckRunProgress(t *testing.T) {
+	fake, client := newFakeCheckRuns(t)
+	var mu sync.Mutex
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	r := &StatusReporter{
+		Checks:           true,
+		ProgressInterval: time.Minute,
+		now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	}
+	msg := &proto.ExecuteTaskRequest{SessionId: "org-repo-8", Github: &proto.GitHubInfo{Repo: "org/repo", PrNumber: 8}}
+	task := &TaskInfo{Request: msg, client: func(context.Context) (*github.Client, error) { return client, nil }}
+	if err := r.OnStart(context.Background(), task); err != nil {
+		t.Fatalf("OnStart failed: %v", err)
+	}
+
+	// 間隔が空くまでは更新しない
+	r.OnOutput(task, OutputLine{Text: "first line"})
+	advance(time.Minute)
+	r.OnOutput(task, OutputLine{Text: "second line"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.recorded()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.OnOutput(task, OutputLine{Text: "third line"})
+	if err := r.OnFinally(context.Background(), task, &TaskResult{}); err != nil {
+		t.Fatalf("OnFinally failed: %v", err)
+	}
+
+	checks := fake.recorded()
+	if len(checks) != 3 {
+		t.Fatalf("expected create, progress and completion, got %v", checks)
+	}
+	progress := checks[1]
+	output, _ := progress["output"].(map[string]any)
+	summary, _ := output["summary"].(string)
+	if progress["method"] != "PATCH /api/v3/repos/org/repo/check-runs/55" || progress["status"] != "in_progress" ||
+		!strings.Contains(summary, "first line\nsecond line") || strings.Contains(summary, "third line") {
+		t.Errorf("unexpected progress update: %v", progress)
+	}
+	if checks[2]["status"] != "completed" {
+		t.Errorf("check run is not completed: %v", checks[2])
+	}
+}
+
+func TestStatusReporterCheckRunSkipsIssues(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+	host, err := githubhost.New(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r := &StatusReporter{Checks: true}
+	msg := &proto.ExecuteTaskRequest{SessionId: "org-repo-7", Github: &proto.GitHubInfo{Repo: "org/repo", IssueNumber: 7}}
+	client := host.NewClient(srv.Client(), "ghs_token")
+	task := &TaskInfo{Request: msg, client: func(context.Context) (*github.Client, error) { return client, nil }}
+	if err := r.OnStart(context.Background(), task); err != nil {
+		t.Fatalf("OnStart failed: %v", err)
+	}
+}
+
+// TestCheckStateCancelledBeforeStart はキュー内でキャンセルされたタスクのチェックランが cancelled で完了することを確認します
+func TestCheckStateCancelledBeforeStart(t *testing.T) {
+	status, conclusion := checkState(&statusReport{status: TaskStatusFailed, err: errors.New("task was cancelled")})
+	if status != checkStatusCompleted || conclusion == nil || *conclusion != "cancelled" {
+		t.Errorf("checkState = %s, %v, want completed, cancelled", status, conclusion)
+	}
+}
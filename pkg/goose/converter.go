@@ -1,8 +1,12 @@
 package goose
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/kommon-ai/agent-connect/gen/proto"
 	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
 )
 
 // ProviderToProto は agent.Provider インターフェースを remote.ProviderInfo に変換します
@@ -160,11 +164,15 @@ func ProtoToGooseGitHub(info *proto.GitHubInfo) *GooseGitHub {
 		return nil
 	}
 
-	// APIURLからホスト部分を抽出
-	host := "https://github.com"
+	// Web のホストは API の URL、リポジトリの URL の順に導出する
+	// どちらもない場合は空のままにし、設定の github_url を使う
+	var host string
 	if info.ApiUrl != "" {
-		// APIURLが提供されている場合は、それをそのまま使用
-		host = info.ApiUrl
+		if h, err := githubhost.FromAPIURL(info.ApiUrl); err == nil {
+			host = strings.TrimSuffix(h.WebURL.String(), "/")
+		}
+	} else if u, err := url.Parse(info.FullRepoUrl); err == nil && u.Scheme != "" && u.Host != "" {
+		host = u.Scheme + "://" + u.Host
 	}
 
 	return &GooseGitHub{
@@ -0,0 +1,151 @@
+package goose
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kommon-ai/goose-connect/pkg/gitcredential"
+)
+
+// CredentialUsername は GitHub App のインストールトークンで認証する際のユーザー名です
+const CredentialUsername = "x-access-token"
+
+// CredentialSource は credential helper がトークンを読む場所です
+// Socket、EnvFile の順に使い、どちらも空の場合は環境変数 GITHUB_TOKEN を使います
+type CredentialSource struct {
+	// Socket は実行中のセッションに最新のトークンを返す goose-connect の UNIX ソケットです (GitHub App の場合)
+	Socket string
+	// EnvFile はセッションの env ファイルです (env_mode が file の場合)
+	EnvFile string
+}
+
+// Token は src からトークンを読み出します
+func (src CredentialSource) Token() (string, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	switch {
+	case src.Socket != "":
+		t, err := readSocketToken(src.Socket)
+		if err != nil {
+			return "", err
+		}
+		token = t
+	case src.EnvFile != "":
+		env, err := ReadEnvFile(src.EnvFile)
+		if err != nil {
+			return "", err
+		}
+		token = env["GITHUB_TOKEN"]
+	}
+	if token == "" {
+		return "", fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+	return token, nil
+}
+
+// credentialHelper は git-credential サブコマンドを呼び出す credential.helper の値を返します
+// トークンは要求のたびに src から読むため、helper の文字列やリモートの URL には含まれません
+func credentialHelper(src CredentialSource, host string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve goose-connect executable: %w", err)
+	}
+	helper := fmt.Sprintf("!%s git-credential --host %s", shellQuote(exe), shellQuote(host))
+	if src.Socket != "" {
+		helper += " --socket " + shellQuote(src.Socket)
+	}
+	if src.EnvFile != "" {
+		helper += " --env-file " + shellQuote(src.EnvFile)
+	}
+	return helper, nil
+}
+
+// LookupCredential は git credential helper の get 要求 req に対して、
+// host 宛ての https の要求であれば src のトークンを返します
+// 対象外の要求には nil を返し、git が他の方法を試せるようにします
+func LookupCredential(src CredentialSource, host string, req *gitcredential.Credential) (*gitcredential.Credential, error) {
+	if req.Protocol != "https" || !strings.EqualFold(req.Host, host) {
+		return nil, nil
+	}
+	token, err := src.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &gitcredential.Credential{
+		Protocol: req.Protocol,
+		Host:     req.Host,
+		Username: CredentialUsername,
+		Password: token,
+	}, nil
+}
+
+// ReadEnvFile は FinalizeEnvFile が書き出した env ファイルを読み込みます
+// 値はシェルと同じ規則でクォートを外しますが、変数やコマンドは展開しません
+func ReadEnvFile(filePath string) (map[string]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	env := make(map[string]string)
+	s := string(data)
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			return env, nil
+		}
+		if strings.HasPrefix(s, "#") {
+			_, s, _ = strings.Cut(s, "\n")
+			continue
+		}
+		s = strings.TrimPrefix(s, "export ")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok || !envKeyPattern.MatchString(key) {
+			line, _, _ := strings.Cut(s, "\n")
+			return nil, fmt.Errorf("invalid env file line: %q", line)
+		}
+		value, rest, err := unquoteShellWord(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		env[key] = value
+		s = rest
+	}
+}
+
+// unquoteShellWord は s の先頭のシェルの 1 語 (クォートを含む) を展開せずに復元し、残りを返します
+func unquoteShellWord(s string) (string, string, error) {
+	var sb strings.Builder
+	i := 0
+	for ; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n':
+			return sb.String(), s[i:], nil
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated single quote")
+			}
+			sb.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`", s[i+1]) >= 0 {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return "", "", fmt.Errorf("unterminated double quote")
+			}
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), "", nil
+}
@@ -0,0 +1,105 @@
+package goose
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kommon-ai/goose-connect/pkg/gitcredential"
+)
+
+func TestLookupCredential(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	if err := os.WriteFile(envFile, []byte("export REPO=\"org/repo\"\nexport GITHUB_TOKEN=\"ghs_token\"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  gitcredential.Credential
+		want *gitcredential.Credential
+	}{
+		{
+			name: "対象のホスト",
+			req:  gitcredential.Credential{Protocol: "https", Host: "github.com", Path: "org/repo.git"},
+			want: &gitcredential.Credential{Protocol: "https", Host: "github.com", Username: CredentialUsername, Password: "ghs_token"},
+		},
+		{
+			name: "別のホストには返さない",
+			req:  gitcredential.Credential{Protocol: "https", Host: "gitlab.com"},
+		},
+		{
+			name: "https 以外には返さない",
+			req:  gitcredential.Credential{Protocol: "http", Host: "github.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LookupCredential(CredentialSource{EnvFile: envFile}, "github.com", &tt.req)
+			if err != nil {
+				t.Fatalf("LookupCredential failed: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("LookupCredential() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// env ファイルを使わない場合は環境変数から読む
+	t.Setenv("GITHUB_TOKEN", "ghs_from_env")
+	got, err := LookupCredential(CredentialSource{}, "github.com", &gitcredential.Credential{Protocol: "https", Host: "github.com"})
+	if err != nil || got.Password != "ghs_from_env" {
+		t.Errorf("expected token from environment, got %+v (err: %v)", got, err)
+	}
+
+	// トークンは要求のたびに読み直すため、env ファイルの更新が反映される
+	if err := os.WriteFile(envFile, []byte("export GITHUB_TOKEN=\"ghs_refreshed\"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	got, err = LookupCredential(CredentialSource{EnvFile: envFile}, "github.com", &gitcredential.Credential{Protocol: "https", Host: "github.com"})
+	if err != nil || got.Password != "ghs_refreshed" {
+		t.Errorf("expected refreshed token, got %+v (err: %v)", got, err)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "ダブルクォート",
+			content: "export A=\"x y\"\nexport B=\"a\\\"b\\$c\"\n",
+			want:    map[string]string{"A": "x y", "B": "a\"b$c"},
+		},
+		{
+			name:    "シングルクォートと連結",
+			content: "export A='it'\"'\"'s'\n# comment\n\nB=plain\n",
+			want:    map[string]string{"A": "it's", "B": "plain"},
+		},
+		{
+			name:    "閉じられていないクォート",
+			content: "export A=\"x\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "env")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write env file: %v", err)
+			}
+			got, err := ReadEnvFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadEnvFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
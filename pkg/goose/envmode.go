@@ -0,0 +1,66 @@
+package goose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnvMode はセッションの環境変数 (トークンや API キーを含む) を goose に渡す方法です
+type EnvMode string
+
+const (
+	// EnvModeProcess は子プロセスの環境変数として直接渡し、ディスクには書き込みません
+	EnvModeProcess EnvMode = "process"
+	// EnvModeFile は <session>/env に書き出し、実行スクリプトで source します (デバッグ用)
+	EnvModeFile EnvMode = "file"
+)
+
+// ParseEnvMode は設定値を EnvMode に変換します
+func ParseEnvMode(s string) (EnvMode, error) {
+	switch m := EnvMode(s); m {
+	case EnvModeProcess, EnvModeFile:
+		return m, nil
+	case "":
+		return EnvModeProcess, nil
+	}
+	return "", fmt.Errorf("unknown env mode: %s", s)
+}
+
+// processEnv は親プロセスの環境変数 parent のうち passthrough に一致するものに env を重ねた、
+// 子プロセスに渡す KEY=VALUE の一覧を返します
+func processEnv(parent []string, passthrough []string, env map[string]string) ([]string, error) {
+	merged := make(map[string]string)
+	for _, kv := range parent {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok && matchEnvName(key, passthrough) {
+			merged[key] = value
+		}
+	}
+	for k, v := range env {
+		if !envKeyPattern.MatchString(k) {
+			return nil, fmt.Errorf("invalid environment variable name: %q", k)
+		}
+		merged[k] = v
+	}
+	result := make([]string, 0, len(merged))
+	for k, v := range merged {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// matchEnvName は name が patterns のいずれかに一致するかを返します (末尾の * は前方一致)
+func matchEnvName(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
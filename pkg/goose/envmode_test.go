@@ -0,0 +1,82 @@
+package goose
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEnvMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    EnvMode
+		wantErr bool
+	}{
+		{input: "", want: EnvModeProcess},
+		{input: "process", want: EnvModeProcess},
+		{input: "file", want: EnvModeFile},
+		{input: "disk", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEnvMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEnvMode(%q) = %q, %v", tt.input, got, err)
+		}
+	}
+}
+
+func TestProcessEnv(t *testing.T) {
+	parent := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/goose",
+		"LC_ALL=C.UTF-8",
+		"GOOSECONNECT_GITHUB_APP_PRIVATE_KEY=secret",
+		"OPENAI_API_KEY=parent-key",
+		"GITHUB_TOKEN=parent-token",
+	}
+	allowlist := []string{"PATH", "HOME", "LC_*"}
+
+	tests := []struct {
+		name        string
+		passthrough []string
+		env         map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "許可された親の環境変数だけを引き継ぎ、セッションの値で上書きする",
+			passthrough: allowlist,
+			env:         map[string]string{"GITHUB_TOKEN": "session-token", "HOME": "/sessions/home"},
+			want:        []string{"GITHUB_TOKEN=session-token", "HOME=/sessions/home", "LC_ALL=C.UTF-8", "PATH=/usr/bin"},
+		},
+		{
+			name:        "* の場合は親の環境変数をすべて引き継ぐ",
+			passthrough: []string{"*"},
+			env:         map[string]string{"GITHUB_TOKEN": "session-token"},
+			want: []string{
+				"GITHUB_TOKEN=session-token",
+				"GOOSECONNECT_GITHUB_APP_PRIVATE_KEY=secret",
+				"HOME=/home/goose",
+				"LC_ALL=C.UTF-8",
+				"OPENAI_API_KEY=parent-key",
+				"PATH=/usr/bin",
+			},
+		},
+		{
+			name:        "不正な名前",
+			passthrough: allowlist,
+			env:         map[string]string{"A=B": "x"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processEnv(parent, tt.passthrough, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
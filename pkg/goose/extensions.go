@@ -0,0 +1,117 @@
+package goose
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+)
+
+// ExtensionsEnvKey は ProviderInfo.Env でタスクごとに使用する MCP 拡張を選択するためのキーです
+// カンマ区切りで拡張の名前を指定し、指定された拡張だけを (無効化されていても) 使用します
+const ExtensionsEnvKey = "GOOSE_CONNECT_EXTENSIONS"
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ResolveExtensions は設定の extensions に repo_extensions の組織・リポジトリごとの上書きを反映し、
+// リクエストによる選択を適用した MCP 拡張の一覧を返します
+//
+// 上書きは同じ名前の拡張を置き換え、指定されていない項目は元の設定を引き継ぎます
+func ResolveExtensions(cfg *config.Config, repo string, provider agent.Provider) ([]ScriptExtension, error) {
+	extensions, err := cfg.GetExtensions()
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := cfg.GetRepoExtensions()
+	if err != nil {
+		return nil, err
+	}
+	repo = strings.ToLower(repo)
+	org, _, _ := strings.Cut(repo, "/")
+	for _, key := range []string{org, repo} {
+		for _, o := range overrides[key] {
+			extensions = mergeExtension(extensions, o)
+		}
+	}
+
+	var selected map[string]bool
+	if provider != nil {
+		if v := provider.GetEnv()[ExtensionsEnvKey]; v != "" {
+			selected = make(map[string]bool)
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					selected[name] = false
+				}
+			}
+		}
+	}
+
+	var result []ScriptExtension
+	for _, e := range extensions {
+		if selected != nil {
+			if _, ok := selected[e.Name]; !ok {
+				continue
+			}
+			selected[e.Name] = true
+		} else if !e.IsEnabled() {
+			continue
+		}
+		if err := validateExtension(e); err != nil {
+			return nil, err
+		}
+		result = append(result, ScriptExtension{Name: e.Name, Command: e.Command, Env: e.Env, Timeout: e.Timeout})
+	}
+	for name, found := range selected {
+		if !found {
+			return nil, fmt.Errorf("unknown extension %q in %s", name, ExtensionsEnvKey)
+		}
+	}
+	return result, nil
+}
+
+// mergeExtension は同じ名前の拡張を o で上書きし、存在しなければ追加します
+func mergeExtension(extensions []config.ExtensionConfig, o config.ExtensionConfig) []config.ExtensionConfig {
+	merged := make([]config.ExtensionConfig, len(extensions))
+	copy(merged, extensions)
+	for i, e := range merged {
+		if e.Name != o.Name {
+			continue
+		}
+		if o.Command != "" {
+			e.Command = o.Command
+		}
+		if o.Env != nil {
+			e.Env = o.Env
+		}
+		if o.Enabled != nil {
+			e.Enabled = o.Enabled
+		}
+		if o.Timeout > 0 {
+			e.Timeout = o.Timeout
+		}
+		merged[i] = e
+		return merged
+	}
+	return append(merged, o)
+}
+
+func validateExtension(e config.ExtensionConfig) error {
+	if e.Name == "" {
+		return fmt.Errorf("extension name is required")
+	}
+	if e.Command == "" {
+		return fmt.Errorf("extension %s: command is required", e.Name)
+	}
+	if e.Timeout < 0 {
+		return fmt.Errorf("extension %s: timeout must not be negative", e.Name)
+	}
+	for _, kv := range e.Env {
+		key, _, ok := strings.Cut(kv, "=")
+		if !ok || !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("extension %s: invalid env entry %q (expected KEY=VALUE)", e.Name, kv)
+		}
+	}
+	return nil
+}
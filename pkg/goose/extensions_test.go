@@ -0,0 +1,107 @@
+package goose
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestResolveExtensions(t *testing.T) {
+	viper.Set("extensions", []map[string]any{
+		{"name": "github", "command": "npx server-github", "env": []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN"}},
+		{"name": "memory-bank", "command": "npx memory-bank"},
+		{"name": "postgres", "command": "npx server-postgres", "enabled": false},
+	})
+	viper.Set("repo_extensions", map[string]any{
+		"org": []map[string]any{
+			{"name": "jira", "command": "npx jira", "env": []string{"JIRA_URL=https://example.atlassian.net"}},
+		},
+		"org/repo": []map[string]any{
+			{"name": "memory-bank", "enabled": false},
+			{"name": "github", "command": "npx server-github@1.0", "timeout": "5m"},
+		},
+		"broken/repo": []map[string]any{
+			{"name": "bad", "command": "npx bad", "env": []string{"NOT A KEY"}},
+		},
+	})
+	defer viper.Set("extensions", nil)
+	defer viper.Set("repo_extensions", nil)
+
+	testCases := []struct {
+		name        string
+		repo        string
+		env         map[string]string
+		expected    []string
+		timeouts    []time.Duration
+		expectError bool
+	}{
+		{
+			name:     "共通の設定のみ",
+			repo:     "other/repo",
+			expected: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN npx server-github", "npx memory-bank"},
+		},
+		{
+			name:     "組織の設定で追加",
+			repo:     "org/another",
+			expected: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN npx server-github", "npx memory-bank", "JIRA_URL=https://example.atlassian.net npx jira"},
+		},
+		{
+			name:     "リポジトリの設定で無効化と置き換え (大文字小文字は区別しない)",
+			repo:     "Org/Repo",
+			expected: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN npx server-github@1.0", "JIRA_URL=https://example.atlassian.net npx jira"},
+			timeouts: []time.Duration{5 * time.Minute, 0},
+		},
+		{
+			name:     "リクエストで選択した拡張は無効化されていても使用する",
+			repo:     "other/repo",
+			env:      map[string]string{ExtensionsEnvKey: "postgres, github"},
+			expected: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN npx server-github", "npx server-postgres"},
+		},
+		{
+			name:        "存在しない拡張の選択",
+			repo:        "other/repo",
+			env:         map[string]string{ExtensionsEnvKey: "slack"},
+			expectError: true,
+		},
+		{
+			name:        "不正な環境変数",
+			repo:        "broken/repo",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &agent.NoopProvider{ProviderName: "openai", Env: tc.env}
+			extensions, err := ResolveExtensions(&config.Config{}, tc.repo, provider)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", extensions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveExtensions failed: %v", err)
+			}
+			var args []string
+			timeouts := make([]time.Duration, len(extensions))
+			for i, e := range extensions {
+				args = append(args, e.Arg())
+				timeouts[i] = e.Timeout
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("extensions = %q, expected %q", args, tc.expected)
+			}
+			if tc.timeouts == nil {
+				tc.timeouts = make([]time.Duration, len(extensions))
+			}
+			if !reflect.DeepEqual(timeouts, tc.timeouts) {
+				t.Errorf("timeouts = %v, expected %v", timeouts, tc.timeouts)
+			}
+		})
+	}
+}
@@ -2,27 +2,126 @@ package goose
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/kommon-ai/agent-connect/gen/proto"
 	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/githubapp"
+	"github.com/kommon-ai/goose-connect/pkg/githubclient"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
+	"github.com/kommon-ai/goose-connect/pkg/redact"
 )
 
-func addLabel(client *github.Client, org, repo string, prNumber int, label string) error {
-	_, _, err := client.Issues.AddLabelsToIssue(context.Background(), org, repo, prNumber, []string{label})
-	return err
+// ErrInterrupted はサーバーのシャットダウンによりタスクが中断された場合の原因です
+var ErrInterrupted = errors.New("task was interrupted by server shutdown")
+
+type GooseAgentFactory struct {
+	// app が設定されている場合、リクエストのトークンの代わりに App のインストールトークンを使う
+	app    *githubapp.App
+	mu     sync.Mutex
+	tokens map[string]*githubapp.TokenSource
+
+	// host はリクエストに接続先がない場合の GitHub です (未設定の場合は github.com)
+	host githubhost.Host
+
+	// hooks はタスクごとに登録順に呼び出します
+	hooks HookChain
 }
 
-func removeLabel(client *github.Client, org, repo string, prNumber int, label string) error {
-	_, err := client.Issues.RemoveLabelForIssue(context.Background(), org, repo, prNumber, label)
-	return err
+// SetHooks はタスクのライフサイクルで呼び出すフックを hooks で置き換えます
+func (f *GooseAgentFactory) SetHooks(hooks ...Hook) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hooks = hooks
 }
 
-type GooseAgentFactory struct {
-	beforeFunc func(msg *proto.ExecuteTaskRequest) error
-	afterFunc  func(msg *proto.ExecuteTaskRequest) error
+// AddHook はタスクのライフサイクルで呼び出すフックを追加します
+func (f *GooseAgentFactory) AddHook(hook Hook) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hooks = append(append(HookChain{}, f.hooks...), hook)
+}
+
+// task は msg のフックに渡す情報とフックを返します
+func (f *GooseAgentFactory) task(msg *proto.ExecuteTaskRequest) (*TaskInfo, HookChain) {
+	f.mu.Lock()
+	hooks := f.hooks
+	f.mu.Unlock()
+	return &TaskInfo{
+		Request: msg,
+		client: func(ctx context.Context) (*github.Client, error) {
+			return f.GitHubClient(ctx, msg)
+		},
+	}, hooks
+}
+
+// SetGitHubHost はリクエストに接続先がない場合の GitHub を設定します
+func (f *GooseAgentFactory) SetGitHubHost(host githubhost.Host) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.host = host
+}
+
+// githubHost は msg のリポジトリがある GitHub の接続先を返します
+func (f *GooseAgentFactory) githubHost(msg *proto.ExecuteTaskRequest) (githubhost.Host, error) {
+	f.mu.Lock()
+	def := f.host
+	f.mu.Unlock()
+	return ResolveGitHubHost(def, ProtoToGooseGitHub(msg.GetGithub()))
+}
+
+// SetGitHubApp は GitHub App として認証するよう設定します
+func (f *GooseAgentFactory) SetGitHubApp(app *githubapp.App) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.app = app
+	f.tokens = make(map[string]*githubapp.TokenSource)
+}
+
+// tokenSource は repo (org/repo) のインストールトークンの TokenSource を返します
+// 同じリポジトリのタスク間でトークンを共有します。App が設定されていなければ nil を返します
+func (f *GooseAgentFactory) tokenSource(repo string) *githubapp.TokenSource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.app == nil {
+		return nil
+	}
+	key := strings.ToLower(repo)
+	if src, ok := f.tokens[key]; ok {
+		return src
+	}
+	owner, name := splitRepo(repo)
+	src := f.app.TokenSource(owner, name)
+	f.tokens[key] = src
+	return src
+}
+
+// githubClient は msg のリポジトリを操作する GitHub API のクライアントと、そのトークンを返します
+func (f *GooseAgentFactory) githubClient(ctx context.Context, msg *proto.ExecuteTaskRequest) (*github.Client, string, error) {
+	host, err := f.githubHost(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	token := msg.GetGithub().GetApiToken()
+	if src := f.tokenSource(msg.GetGithub().GetRepo()); src != nil {
+		t, err := src.Token(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get installation token: %w", err)
+		}
+		token = t
+	}
+	return host.NewClient(githubclient.NewHTTPClient(), token), token, nil
+}
+
+// GitHubClient は msg のリポジトリを操作する GitHub API のクライアントを返します
+func (f *GooseAgentFactory) GitHubClient(ctx context.Context, msg *proto.ExecuteTaskRequest) (*github.Client, error) {
+	client, _, err := f.githubClient(ctx, msg)
+	return client, err
 }
 
 func prOrIssueNumber(gh *proto.GitHubInfo) (int, error) {
@@ -44,63 +143,99 @@ func splitRepo(repo string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// NewGooseAgentFactory は GooseAgentFactory を作成します
+// SetHooks で置き換えるまでは、実行中のラベルの付け外しと、中断やタイムアウトのコメントを行います
 func NewGooseAgentFactory() *GooseAgentFactory {
-	return &GooseAgentFactory{
-		beforeFunc: func(msg *proto.ExecuteTaskRequest) error {
-			githubClient := github.NewTokenClient(context.Background(), msg.Github.ApiToken)
-			num, err := prOrIssueNumber(msg.Github)
-			if err != nil {
-				return err
-			}
-			org, repo := splitRepo(msg.Github.GetRepo())
-			return addLabel(githubClient, org, repo, num, "goose-running")
-		},
-		afterFunc: func(msg *proto.ExecuteTaskRequest) error {
-			githubClient := github.NewTokenClient(context.Background(), msg.Github.ApiToken)
-			num, err := prOrIssueNumber(msg.Github)
-			if err != nil {
-				return err
-			}
-			org, repo := splitRepo(msg.Github.GetRepo())
-			return removeLabel(githubClient, org, repo, num, "goose-running")
+	f := &GooseAgentFactory{
+		hooks: HookChain{
+			&StatusReporter{Labels: config.StatusLabels{Running: "goose-running"}},
+			FailureCommentHook{},
 		},
 	}
+	return f
+}
+
+// HandleTaskQueued はタスクが他のタスクの終了を待つ場合に呼ばれ、フックの OnQueued を呼び出します
+func (f *GooseAgentFactory) HandleTaskQueued(msg *proto.ExecuteTaskRequest) error {
+	task, hooks := f.task(msg)
+	return hooks.OnQueued(context.Background(), task)
+}
+
+// HandleTaskDropped はキュー内のタスクが開始前にキャンセルやシャットダウンで取り除かれた場合に呼ばれ、
+// cause を失敗の原因としてフックの OnFailure と OnFinally を呼び出します
+func (f *GooseAgentFactory) HandleTaskDropped(msg *proto.ExecuteTaskRequest, cause error) error {
+	task, hooks := f.task(msg)
+	ctx := context.Background()
+	result := &TaskResult{ExitCode: -1, Err: cause}
+	return errors.Join(hooks.OnFailure(ctx, task, result), hooks.OnFinally(ctx, task, result))
+}
+
+// FailureCommentHook は中断、タイムアウト、試行回数の上限で失敗したタスクの理由を issue/PR にコメントする Hook です
+type FailureCommentHook struct {
+	NopHook
+}
+
+func (FailureCommentHook) OnFailure(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	msg := task.Request
+	taskErr := result.Err
+	var body string
+	switch {
+	case errors.Is(taskErr, ErrInterrupted):
+		body = fmt.Sprintf("goose-connect のシャットダウンにより、セッション `%s` の実行を中断しました (interrupted)。\n再度実行を依頼してください。", msg.SessionId)
+	case errors.Is(taskErr, ErrTaskTimeout):
+		body = fmt.Sprintf("セッション `%s` は実行時間の上限に達したため中断しました (timeout)。\n\n```\n%v\n```\n\n上限は設定の `task_timeout`、またはリクエストの `%s` で変更できます。", msg.SessionId, taskErr, TaskTimeoutEnvKey)
+	case errors.Is(taskErr, ErrAttemptsExhausted):
+		body = fmt.Sprintf("セッション `%s` は goose の実行が試行回数の上限まで失敗したため中断しました (max attempts)。\n\n```\n%v\n```\n\n上限は設定の `max_attempts`、またはリクエストの `%s` で変更できます。", msg.SessionId, taskErr, MaxAttemptsEnvKey)
+	default:
+		return nil
+	}
+	client, err := task.GitHub(ctx)
+	if err != nil {
+		return err
+	}
+	num, err := prOrIssueNumber(msg.Github)
+	if err != nil {
+		return err
+	}
+	org, repo := splitRepo(msg.Github.GetRepo())
+	// エラーには goose やリモートの出力が含まれることがある
+	body = redact.New(msg.GetGithub().GetApiToken(), msg.GetProvider().GetApiKey()).String(body)
+	_, _, err = client.Issues.CreateComment(ctx, org, repo, num, &github.IssueComment{Body: github.String(body)})
+	return err
 }
 
 func (f *GooseAgentFactory) NewAgentFactory() func(msg *proto.ExecuteTaskRequest) (agent.Agent, error) {
 	return func(msg *proto.ExecuteTaskRequest) (agent.Agent, error) {
-		gooseAgent, err := ProtoToGooseAgent(msg.Provider, msg.Github, msg.Instruction, msg.SessionId)
-		if err != nil {
-			return nil, err
+		if msg.Provider == nil || msg.Github == nil {
+			return nil, nil
 		}
-		return gooseAgent, nil
+		opts := ProtoToGooseOptions(msg.Provider, msg.Github, msg.Instruction, msg.SessionId)
+		opts.Tokens = f.tokenSource(msg.Github.GetRepo())
+		opts.Task, opts.Hooks = f.task(msg)
+		return NewGooseAgent(opts)
 	}
 }
 
+// GetAfterTaskExecutionFunc は何もしない関数を返します
+// 実行前後の処理はエージェントの Execute の中でフックとして呼び出します
 func (f *GooseAgentFactory) GetAfterTaskExecutionFunc() func(msg *proto.ExecuteTaskRequest) error {
-	if f.afterFunc == nil {
-		return func(msg *proto.ExecuteTaskRequest) error {
-			return fmt.Errorf("afterFunc is not set")
-		}
-	}
-	return f.afterFunc
+	return func(msg *proto.ExecuteTaskRequest) error { return nil }
 }
 
+// GetBeforeTaskExecutionFunc は何もしない関数を返します
+// 実行前後の処理はエージェントの Execute の中でフックとして呼び出します
 func (f *GooseAgentFactory) GetBeforeTaskExecutionFunc() func(msg *proto.ExecuteTaskRequest) error {
-	if f.beforeFunc == nil {
-		return func(msg *proto.ExecuteTaskRequest) error {
-			return fmt.Errorf("beforeFunc is not set")
-		}
-	}
-	return f.beforeFunc
+	return func(msg *proto.ExecuteTaskRequest) error { return nil }
 }
 
+// SetAfterTaskExecutionFunc は afterFunc をタスクの終了時 (OnFinally) に呼び出すフックとして追加します
 func (f *GooseAgentFactory) SetAfterTaskExecutionFunc(afterFunc func(msg *proto.ExecuteTaskRequest) error) error {
-	f.afterFunc = afterFunc
+	f.AddHook(TaskFuncHook{After: afterFunc})
 	return nil
 }
 
+// SetBeforeTaskExecutionFunc は beforeFunc をタスクの開始時 (OnStart) に呼び出すフックとして追加します
 func (f *GooseAgentFactory) SetBeforeTaskExecutionFunc(beforeFunc func(msg *proto.ExecuteTaskRequest) error) error {
-	f.beforeFunc = beforeFunc
+	f.AddHook(TaskFuncHook{Before: beforeFunc})
 	return nil
 }
@@ -1,13 +1,19 @@
 package goose
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kommon-ai/agent-go/pkg/agent"
 	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/session"
 	"github.com/spf13/viper"
 )
 
@@ -50,6 +56,8 @@ func TestGooseEnvGetEnv(t *testing.T) {
 		ScriptFIlePath:      "/tmp/test-script.sh",
 		EnvFilePath:         "/tmp/test-env.sh",
 		BranchName:          "test-branch",
+		GitUserName:         "test-user",
+		GitUserEmail:        "test@example.com",
 	}
 
 	// GetEnvメソッドを実行
@@ -68,6 +76,10 @@ func TestGooseEnvGetEnv(t *testing.T) {
 		"SCRIPT_FILE_PATH":      "/tmp/test-script.sh",
 		"ENV_FILE_PATH":         "/tmp/test-env.sh",
 		"PR_BRANCH":             "test-branch",
+		"GIT_AUTHOR_NAME":       "test-user",
+		"GIT_AUTHOR_EMAIL":      "test@example.com",
+		"GIT_COMMITTER_NAME":    "test-user",
+		"GIT_COMMITTER_EMAIL":   "test@example.com",
 	}
 
 	for key, expectedValue := range expectedValues {
@@ -468,43 +480,6 @@ func TestImportEventURL(t *testing.T) {
 	}
 }
 
-// TestGetExecutionScriptFile tests the getExecutionScriptFile method
-func TestGetExecutionScriptFile(t *testing.T) {
-	// Create a temporary directory for testing
-	tempDir, err := os.MkdirTemp("", "goose-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Create a mock config
-	mockCfg := &config.Config{}
-
-	// Create a mock agent
-	agent := &GooseAgent{
-		baseDir: tempDir,
-		cfg:     mockCfg,
-	}
-
-	// Test the getExecutionScriptFile function
-	scriptContent := agent.getExecutionScriptFile("/path/to/env/file")
-
-	// Verify that the script content is not empty
-	if scriptContent == "" {
-		t.Errorf("Expected non-empty script content, got empty string")
-	}
-
-	// Check if the script contains expected content
-	if !strings.Contains(scriptContent, "#!/bin/bash") {
-		t.Errorf("Script content does not contain expected header")
-	}
-
-	// Check if the script contains the run_goose function
-	if !strings.Contains(scriptContent, "run_goose()") {
-		t.Errorf("Script content does not contain run_goose function")
-	}
-}
-
 // TestGetInstructionScript tests the getInstructionScript method
 func TestGetInstructionScript(t *testing.T) {
 	// Create a temporary directory for testing
@@ -589,3 +564,121 @@ func TestGetInstructionScript(t *testing.T) {
 	}
 }
 
+func TestFinishRunRecordsCancellation(t *testing.T) {
+	sessionDir := t.TempDir()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cmd := exec.CommandContext(ctx, "bash", "-c", "sleep 60")
+	newProcessGroup(cmd, time.Second)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+	cancel(errors.New("cancelled by test"))
+	execErr := cmd.Wait()
+	if execErr == nil {
+		t.Fatalf("expected error from cancelled command")
+	}
+
+	n, runDir, err := session.NewRunDir(sessionDir)
+	if err != nil {
+		t.Fatalf("NewRunDir failed: %v", err)
+	}
+	run := &session.Run{Number: n, Status: session.RunStatusRunning, StartedAt: time.Now()}
+	if err := finishRun(ctx, runDir, run, cmd, execErr); err != nil {
+		t.Fatalf("finishRun failed: %v", err)
+	}
+	recorded, err := session.ReadRun(sessionDir, n)
+	if err != nil {
+		t.Fatalf("ReadRun failed: %v", err)
+	}
+	if recorded.Status != session.RunStatusCancelled || !strings.Contains(recorded.Error, "cancelled by test") {
+		t.Errorf("recorded run = %+v, expected cancelled with cause", recorded)
+	}
+}
+
+// mapEnv はテスト用の任意の環境変数を持つ AgentEnv 実装です
+type mapEnv map[string]string
+
+func (m mapEnv) GetEnv() map[string]string  { return m }
+func (m mapEnv) GetRequiredEnv() []string   { return nil }
+func (m mapEnv) ValidateRequiredEnv() error { return nil }
+
+// sourceEnvFile は bash で env ファイルを source し、key の値を返します
+func sourceEnvFile(t *testing.T, path, key string) string {
+	t.Helper()
+	// #nosec G204 -- test helper
+	out, err := exec.Command("bash", "-c", `source "$1" && printf '%s' "${!2}"`, "bash", path, key).Output()
+	if err != nil {
+		t.Fatalf("Failed to source env file: %v", err)
+	}
+	return string(out)
+}
+
+func TestFinalizeEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "env")
+	values := mapEnv{
+		"QUOTE":     `a"b'c`,
+		"EXPANSION": "$HOME `id` $(id) ${PATH}",
+		"NEWLINE":   "line1\nline2",
+		"BRANCH":    "feature/it's-\\done",
+		"EMPTY":     "",
+	}
+	if err := FinalizeEnvFile(path, values); err != nil {
+		t.Fatalf("FinalizeEnvFile failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat env file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("env file permission = %o, want 600", perm)
+	}
+	parsed, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile failed: %v", err)
+	}
+	for k, v := range values {
+		if got := sourceEnvFile(t, path, k); got != v {
+			t.Errorf("sourced %s = %q, want %q", k, got, v)
+		}
+		if parsed[k] != v {
+			t.Errorf("ReadEnvFile %s = %q, want %q", k, parsed[k], v)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files are left in the session directory: %v", entries)
+	}
+
+	for _, invalid := range []mapEnv{
+		{"": "value"},
+		{"A=B": "value"},
+		{"A;id": "value"},
+		{"NUL": "a\x00b"},
+	} {
+		if err := FinalizeEnvFile(path, invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func FuzzFinalizeEnvFile(f *testing.F) {
+	for _, seed := range []string{"", "plain", `"`, "'", "$HOME", "`id`", "$(id)", "\\", "a\nb", "it's \"x\" $y `z` \\"} {
+		f.Add(seed)
+	}
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, value string) {
+		if strings.ContainsRune(value, 0) {
+			t.Skip("shell variables cannot contain NUL")
+		}
+		path := filepath.Join(dir, "env")
+		if err := FinalizeEnvFile(path, mapEnv{"VALUE": value}); err != nil {
+			t.Fatalf("FinalizeEnvFile failed: %v", err)
+		}
+		if got := sourceEnvFile(t, path, "VALUE"); got != value {
+			t.Errorf("sourced value = %q, want %q", got, value)
+		}
+		if parsed, err := ReadEnvFile(path); err != nil || parsed["VALUE"] != value {
+			t.Errorf("ReadEnvFile value = %q (err: %v), want %q", parsed["VALUE"], err, value)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// TaskInfo はフックに渡すタスクの情報です
+type TaskInfo struct {
+	Request *proto.ExecuteTaskRequest
+	// client はタスクのリポジトリを操作する GitHub API のクライアントを返します
+	client func(ctx context.Context) (*github.Client, error)
+}
+
+// GitHub はタスクのリポジトリを操作する GitHub API のクライアントを返します
+func (t *TaskInfo) GitHub(ctx context.Context) (*github.Client, error) {
+	if t.client == nil {
+		return nil, errors.New("GitHub client is not available for this task")
+	}
+	return t.client(ctx)
+}
+
+// TaskResult はフックに渡すタスクの実行結果です
+type TaskResult struct {
+	// ExitCode は実行スクリプトの終了コードです (スクリプトを起動する前に失敗した場合は -1)
+	ExitCode int
+	Duration time.Duration
+	// Err は失敗の原因です (成功した場合は nil)。秘密情報は取り除かれています
+	Err error
+	// ChangedFiles は開始時点のコミットから変更、追加されたファイルのリポジトリ内のパスです
+	ChangedFiles []string
+	// Output は出力の末尾です
+	Output string
+	// Run はこのタスクで作成した実行記録です (実行記録を作成する前に失敗した場合は nil)
+	Run *session.Run
+}
+
+// Hook はタスクのライフサイクルの各時点で呼ばれる処理です
+// 必要なメソッドだけを実装する場合は NopHook を埋め込みます
+//
+// OnSuccess と OnFailure のどちらか一方の後に、OnFinally が必ず呼ばれます
+// OnStart が失敗してもタスクは実行され、OnFinally も呼ばれます
+// 開始前にキャンセルされたタスクは、OnStart を呼ばずに OnFailure と OnFinally が呼ばれます
+type Hook interface {
+	// OnQueued はタスクが他のタスクの終了を待つ場合に呼ばれます
+	OnQueued(ctx context.Context, task *TaskInfo) error
+	OnStart(ctx context.Context, task *TaskInfo) error
+	// OnOutput は goose の出力 1 行ごとに呼ばれます。実行を止めないよう、すぐに戻る必要があります
+	OnOutput(task *TaskInfo, line OutputLine)
+	OnSuccess(ctx context.Context, task *TaskInfo, result *TaskResult) error
+	OnFailure(ctx context.Context, task *TaskInfo, result *TaskResult) error
+	OnFinally(ctx context.Context, task *TaskInfo, result *TaskResult) error
+}
+
+// NopHook は何もしない Hook です
+type NopHook struct{}
+
+func (NopHook) OnQueued(context.Context, *TaskInfo) error               { return nil }
+func (NopHook) OnStart(context.Context, *TaskInfo) error                { return nil }
+func (NopHook) OnOutput(*TaskInfo, OutputLine)                          {}
+func (NopHook) OnSuccess(context.Context, *TaskInfo, *TaskResult) error { return nil }
+func (NopHook) OnFailure(context.Context, *TaskInfo, *TaskResult) error { return nil }
+func (NopHook) OnFinally(context.Context, *TaskInfo, *TaskResult) error { return nil }
+
+// TaskFuncHook はタスクのリクエストだけを受け取る関数をフックとして呼び出します
+// AgentFactory の SetBeforeTaskExecutionFunc と SetAfterTaskExecutionFunc で登録した関数に使います
+type TaskFuncHook struct {
+	NopHook
+	// Before はタスクの開始時に呼ばれます
+	Before func(msg *proto.ExecuteTaskRequest) error
+	// After はタスクの終了時に成否にかかわらず呼ばれます
+	After func(msg *proto.ExecuteTaskRequest) error
+}
+
+func (h TaskFuncHook) OnStart(ctx context.Context, task *TaskInfo) error {
+	if h.Before == nil {
+		return nil
+	}
+	return h.Before(task.Request)
+}
+
+func (h TaskFuncHook) OnFinally(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	if h.After == nil {
+		return nil
+	}
+	return h.After(task.Request)
+}
+
+// HookChain は複数のフックを登録順に呼び出します
+// 途中のフックが失敗しても残りのフックを呼び出し、エラーはまとめて返します
+type HookChain []Hook
+
+func (c HookChain) each(fn func(h Hook) error) error {
+	var errs []error
+	for _, h := range c {
+		if err := fn(h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c HookChain) OnQueued(ctx context.Context, task *TaskInfo) error {
+	return c.each(func(h Hook) error { return h.OnQueued(ctx, task) })
+}
+
+func (c HookChain) OnStart(ctx context.Context, task *TaskInfo) error {
+	return c.each(func(h Hook) error { return h.OnStart(ctx, task) })
+}
+
+func (c HookChain) OnOutput(task *TaskInfo, line OutputLine) {
+	for _, h := range c {
+		h.OnOutput(task, line)
+	}
+}
+
+func (c HookChain) OnSuccess(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	return c.each(func(h Hook) error { return h.OnSuccess(ctx, task, result) })
+}
+
+func (c HookChain) OnFailure(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	return c.each(func(h Hook) error { return h.OnFailure(ctx, task, result) })
+}
+
+func (c HookChain) OnFinally(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	return c.each(func(h Hook) error { return h.OnFinally(ctx, task, result) })
+}
+
+// hookSink は goose の出力をフックの OnOutput に渡します
+type hookSink struct {
+	hooks HookChain
+	task  *TaskInfo
+}
+
+func (s *hookSink) WriteLine(line OutputLine) error {
+	s.hooks.OnOutput(s.task, line)
+	return nil
+}
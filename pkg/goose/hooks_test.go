@@ -0,0 +1,122 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/redact"
+	"github.com/spf13/viper"
+)
+
+// recordingHook は呼ばれたメソッドを記録し、startErr を OnStart から返します
+type recordingHook struct {
+	NopHook
+	name     string
+	calls    *[]string
+	startErr error
+	result   *TaskResult
+}
+
+func (h *recordingHook) OnStart(ctx context.Context, task *TaskInfo) error {
+	*h.calls = append(*h.calls, h.name+".OnStart")
+	return h.startErr
+}
+
+func (h *recordingHook) OnSuccess(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	*h.calls = append(*h.calls, h.name+".OnSuccess")
+	return nil
+}
+
+func (h *recordingHook) OnFailure(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	*h.calls = append(*h.calls, h.name+".OnFailure")
+	h.result = result
+	return nil
+}
+
+func (h *recordingHook) OnFinally(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	*h.calls = append(*h.calls, h.name+".OnFinally")
+	return fmt.Errorf("%s finally failed", h.name)
+}
+
+func TestHookChain(t *testing.T) {
+	var calls []string
+	chain := HookChain{
+		&recordingHook{name: "a", calls: &calls, startErr: errors.New("a start failed")},
+		&recordingHook{name: "b", calls: &calls},
+	}
+	task := &TaskInfo{Request: &proto.ExecuteTaskRequest{SessionId: "s"}}
+
+	if err := chain.OnStart(context.Background(), task); err == nil || !strings.Contains(err.Error(), "a start failed") {
+		t.Errorf("OnStart error = %v", err)
+	}
+	err := chain.OnFinally(context.Background(), task, &TaskResult{})
+	if err == nil || !strings.Contains(err.Error(), "a finally failed") || !strings.Contains(err.Error(), "b finally failed") {
+		t.Errorf("OnFinally must join errors of all hooks: %v", err)
+	}
+	want := []string{"a.OnStart", "b.OnStart", "a.OnFinally", "b.OnFinally"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+// TestExecuteCallsHooksOnFailure は開始前のフックが失敗し、goose を起動する前に Execute が失敗しても
+// OnFailure と OnFinally が結果とともに呼ばれることを確認します
+func TestExecuteCallsHooksOnFailure(t *testing.T) {
+	viper.Set("session_lock_policy", "unknown")
+	defer viper.Set("session_lock_policy", "wait")
+
+	var calls []string
+	first := &recordingHook{name: "a", calls: &calls, startErr: errors.New("label failed")}
+	second := &recordingHook{name: "b", calls: &calls}
+	agent := &GooseAgent{
+		cfg:      &config.Config{},
+		Env:      &GooseEnv{InstallationToken: "ghs_secret_token"},
+		redactor: redact.New("ghs_secret_token"),
+		Opts: GooseOptions{
+			SessionID: "org-repo-1",
+			Hooks:     HookChain{first, second},
+			Task:      &TaskInfo{Request: &proto.ExecuteTaskRequest{SessionId: "org-repo-1"}},
+		},
+	}
+	if _, err := agent.Execute(context.Background(), "hello"); err == nil {
+		t.Fatalf("Execute must fail with an unknown lock policy")
+	}
+	want := []string{"a.OnStart", "b.OnStart", "a.OnFailure", "b.OnFailure", "a.OnFinally", "b.OnFinally"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if second.result == nil || second.result.Err == nil || second.result.ExitCode != -1 || second.result.Run != nil {
+		t.Errorf("unexpected result: %+v", second.result)
+	}
+}
+
+// TestTaskExecutionFuncsRunAsHooks は AgentFactory の実行前後の関数がフックとして呼ばれることを確認します
+func TestTaskExecutionFuncsRunAsHooks(t *testing.T) {
+	var calls []string
+	f := &GooseAgentFactory{}
+	_ = f.SetBeforeTaskExecutionFunc(func(msg *proto.ExecuteTaskRequest) error {
+		calls = append(calls, "before:"+msg.SessionId)
+		return errors.New("before failed")
+	})
+	_ = f.SetAfterTaskExecutionFunc(func(msg *proto.ExecuteTaskRequest) error {
+		calls = append(calls, "after:"+msg.SessionId)
+		return nil
+	})
+
+	task, hooks := f.task(&proto.ExecuteTaskRequest{SessionId: "s"})
+	if err := hooks.OnStart(context.Background(), task); err == nil || !strings.Contains(err.Error(), "before failed") {
+		t.Errorf("OnStart error = %v", err)
+	}
+	if err := hooks.OnFinally(context.Background(), task, &TaskResult{}); err != nil {
+		t.Errorf("OnFinally failed: %v", err)
+	}
+	want := []string{"before:s", "after:s"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
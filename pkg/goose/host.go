@@ -0,0 +1,49 @@
+package goose
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
+)
+
+// DefaultGitHubHost は設定の github_url, github_api_url, github_upload_url から既定の接続先を返します
+func DefaultGitHubHost(cfg *config.Config) (githubhost.Host, error) {
+	return githubhost.New(cfg.GetGitHubURL(), cfg.GetGitHubAPIURL(), cfg.GetGitHubUploadURL())
+}
+
+// ResolveGitHubHost は gh のリポジトリがある GitHub の接続先を返します
+// リクエストの API の URL、リポジトリの URL の順に使い、どちらもなければ def を返します
+// def と同じホストの場合は def (設定で上書きした API などの URL) を使います
+func ResolveGitHubHost(def githubhost.Host, gh agent.GitHub) (githubhost.Host, error) {
+	if def.WebURL == nil {
+		def = githubhost.DotCom
+	}
+	if gh == nil {
+		return def, nil
+	}
+	if apiURL := gh.GetAPIURL(); apiURL != "" {
+		host, err := githubhost.FromAPIURL(apiURL)
+		if err != nil {
+			return githubhost.Host{}, err
+		}
+		if host.APIURL.String() == def.APIURL.String() {
+			return def, nil
+		}
+		return host, nil
+	}
+	if repoURL := gh.GetFullRepoURL(); repoURL != "" {
+		u, err := url.Parse(repoURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return githubhost.Host{}, fmt.Errorf("invalid repository URL: %s", repoURL)
+		}
+		if strings.EqualFold(u.Host, def.Hostname()) {
+			return def, nil
+		}
+		return githubhost.New(u.Scheme+"://"+u.Host, "", "")
+	}
+	return def, nil
+}
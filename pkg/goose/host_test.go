@@ -0,0 +1,156 @@
+package goose
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
+)
+
+func TestResolveGitHubHost(t *testing.T) {
+	def, err := githubhost.New("https://ghe.example.com", "https://ghe-api.example.com", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	testCases := []struct {
+		name    string
+		info    *proto.GitHubInfo
+		wantWeb string
+		wantAPI string
+	}{
+		{
+			name:    "接続先の指定がなければ設定を使う",
+			info:    &proto.GitHubInfo{Repo: "org/repo"},
+			wantWeb: "https://ghe.example.com/",
+			wantAPI: "https://ghe-api.example.com/",
+		},
+		{
+			name:    "API の URL から Web のホストを導出する",
+			info:    &proto.GitHubInfo{Repo: "org/repo", ApiUrl: "https://api.github.com"},
+			wantWeb: "https://github.com/",
+			wantAPI: "https://api.github.com/",
+		},
+		{
+			name:    "リポジトリの URL のホスト",
+			info:    &proto.GitHubInfo{Repo: "org/repo", FullRepoUrl: "https://other.example.com/org/repo"},
+			wantWeb: "https://other.example.com/",
+			wantAPI: "https://other.example.com/api/v3/",
+		},
+		{
+			name:    "設定と同じホストなら設定の API の URL を使う",
+			info:    &proto.GitHubInfo{Repo: "org/repo", FullRepoUrl: "https://ghe.example.com/org/repo"},
+			wantWeb: "https://ghe.example.com/",
+			wantAPI: "https://ghe-api.example.com/",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			host, err := ResolveGitHubHost(def, ProtoToGooseGitHub(tc.info))
+			if err != nil {
+				t.Fatalf("ResolveGitHubHost failed: %v", err)
+			}
+			if host.WebURL.String() != tc.wantWeb || host.APIURL.String() != tc.wantAPI {
+				t.Errorf("got web=%s api=%s", host.WebURL, host.APIURL)
+			}
+		})
+	}
+}
+
+func TestImportEventURLRecordsHost(t *testing.T) {
+	g := &GooseGitHub{Repo: "org/repo", APIURL: "https://api.github.com"}
+	if err := g.ImportEventURL("https://ghe.example.com/org/repo/pull/12"); err != nil {
+		t.Fatalf("ImportEventURL failed: %v", err)
+	}
+	if g.Host != "https://ghe.example.com" || g.APIURL != "" {
+		t.Errorf("Host = %q, APIURL = %q", g.Host, g.APIURL)
+	}
+	if got := g.GetFullRepoURL(); got != "https://ghe.example.com/org/repo" {
+		t.Errorf("GetFullRepoURL() = %s", got)
+	}
+	host, err := ResolveGitHubHost(githubhost.DotCom, g)
+	if err != nil {
+		t.Fatalf("ResolveGitHubHost failed: %v", err)
+	}
+	if host.APIURL.String() != "https://ghe.example.com/api/v3/" {
+		t.Errorf("API URL = %s", host.APIURL)
+	}
+}
+
+// TestFactoryLabelsOnEnterpriseServer は GitHub Enterprise Server の代わりの httptest サーバーにラベルを付け外しします
+func TestFactoryLabelsOnEnterpriseServer(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		name string
+		host githubhost.Host
+		info *proto.GitHubInfo
+	}{
+		{
+			name: "リクエストの API の URL",
+			info: &proto.GitHubInfo{ApiToken: "ghs_token", ApiUrl: srv.URL + "/api/v3/", Repo: "org/repo", IssueNumber: 7},
+		},
+		{
+			name: "設定の github_url",
+			host: func() githubhost.Host {
+				h, err := githubhost.New(srv.URL, "", "")
+				if err != nil {
+					t.Fatalf("New failed: %v", err)
+				}
+				return h
+			}(),
+			info: &proto.GitHubInfo{ApiToken: "ghs_token", Repo: "org/repo", IssueNumber: 7},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = nil
+			f := NewGooseAgentFactory()
+			if tc.host.WebURL != nil {
+				f.SetGitHubHost(tc.host)
+			}
+			msg := &proto.ExecuteTaskRequest{SessionId: "org-repo-7", Github: tc.info}
+			task, hooks := f.task(msg)
+			if err := hooks.OnStart(context.Background(), task); err != nil {
+				t.Fatalf("OnStart failed: %v", err)
+			}
+			if err := hooks.OnFinally(context.Background(), task, &TaskResult{}); err != nil {
+				t.Fatalf("OnFinally failed: %v", err)
+			}
+			want := []string{
+				"POST /api/v3/repos/org/repo/issues/7/labels Bearer ghs_token",
+				"DELETE /api/v3/repos/org/repo/issues/7/labels/goose-running Bearer ghs_token",
+			}
+			if len(requests) != len(want) {
+				t.Fatalf("requests = %q", requests)
+			}
+			for i := range want {
+				if requests[i] != want[i] {
+					t.Errorf("request %d = %q, want %q", i, requests[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGooseEnvGetEnvEnterprise(t *testing.T) {
+	env := (&GooseEnv{InstallationToken: "ghs_token", GitHubEnterpriseURL: "https://ghe.example.com"}).GetEnv()
+	if env["GH_HOST"] != "ghe.example.com" || env["GH_ENTERPRISE_TOKEN"] != "ghs_token" || env["GITHUB_HOST"] != "https://ghe.example.com" {
+		t.Errorf("unexpected enterprise env: GH_HOST=%q GITHUB_HOST=%q", env["GH_HOST"], env["GITHUB_HOST"])
+	}
+	if _, ok := (&GooseEnv{}).GetEnv()["GH_HOST"]; ok {
+		t.Errorf("GH_HOST must not be set for github.com")
+	}
+}
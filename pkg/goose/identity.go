@@ -0,0 +1,71 @@
+package goose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/kommon-ai/goose-connect/pkg/workspace"
+)
+
+// コミットの署名の形式です
+const (
+	SigningFormatSSH     = "ssh"
+	SigningFormatOpenPGP = "openpgp"
+)
+
+// signing は設定に応じたコミットの署名の設定を返します (署名しない場合は nil)
+// openpgp の場合は鍵をセッションの GNUPGHOME に取り込み、その鍵 ID を使います
+func (a *GooseAgent) signing(ctx context.Context, env *GooseEnv) (*workspace.Signing, error) {
+	key := a.identity.SigningKey
+	if key == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(key); err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	switch a.identity.SigningFormat {
+	case SigningFormatSSH:
+		return &workspace.Signing{Format: SigningFormatSSH, Key: key}, nil
+	case SigningFormatOpenPGP:
+		fingerprint, err := importGPGKey(ctx, env.GnupgHome, key)
+		if err != nil {
+			return nil, err
+		}
+		return &workspace.Signing{Format: SigningFormatOpenPGP, Key: fingerprint}, nil
+	}
+	return nil, fmt.Errorf("unsupported signing format: %s", a.identity.SigningFormat)
+}
+
+// importGPGKey は keyPath の秘密鍵を gnupgHome に取り込み、その指紋を返します
+func importGPGKey(ctx context.Context, gnupgHome, keyPath string) (string, error) {
+	if err := os.MkdirAll(gnupgHome, 0700); err != nil {
+		return "", fmt.Errorf("failed to create GNUPGHOME: %w", err)
+	}
+	// #nosec G204 -- keyPath and gnupgHome come from the server configuration
+	if out, err := exec.CommandContext(ctx, "gpg", "--batch", "--homedir", gnupgHome, "--import", keyPath).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to import signing key: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	// #nosec G204 -- keyPath and gnupgHome come from the server configuration
+	out, err := exec.CommandContext(ctx, "gpg", "--batch", "--homedir", gnupgHome, "--with-colons", "--import-options", "show-only", "--import", keyPath).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read signing key: %w", err)
+	}
+	// 主鍵 (sec) の直後の fpr 行が指紋
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	inSecretKey := false
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		switch {
+		case fields[0] == "sec":
+			inSecretKey = true
+		case fields[0] == "fpr" && inSecretKey && len(fields) > 9:
+			return fields[9], nil
+		}
+	}
+	return "", fmt.Errorf("no secret key found in %s", keyPath)
+}
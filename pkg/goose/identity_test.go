@@ -0,0 +1,59 @@
+package goose
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportGPGKey(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	// gpg-agent のソケットのパス長の制限を避けるため短いパスを使う
+	root, err := os.MkdirTemp("/tmp", "gpg")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		_ = exec.Command("gpgconf", "--homedir", filepath.Join(root, "src"), "--kill", "gpg-agent").Run()
+		_ = exec.Command("gpgconf", "--homedir", filepath.Join(root, "dst"), "--kill", "gpg-agent").Run()
+		os.RemoveAll(root)
+	}()
+
+	src := filepath.Join(root, "src")
+	if err := os.MkdirAll(src, 0700); err != nil {
+		t.Fatalf("Failed to create GNUPGHOME: %v", err)
+	}
+	gen := exec.Command("gpg", "--batch", "--homedir", src, "--passphrase", "", "--quick-gen-key", "goose-bot <goose@example.com>", "ed25519", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("gpg cannot generate keys in this environment: %v\n%s", err, out)
+	}
+	keyPath := filepath.Join(root, "key.asc")
+	export, err := exec.Command("gpg", "--batch", "--homedir", src, "--armor", "--export-secret-keys").Output()
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	if err := os.WriteFile(keyPath, export, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	listing, err := exec.Command("gpg", "--batch", "--homedir", src, "--with-colons", "--list-secret-keys").Output()
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+
+	fingerprint, err := importGPGKey(context.Background(), filepath.Join(root, "dst"), keyPath)
+	if err != nil {
+		t.Fatalf("importGPGKey failed: %v", err)
+	}
+	if len(fingerprint) != 40 || !strings.Contains(string(listing), "fpr:::::::::"+fingerprint+":") {
+		t.Errorf("fingerprint %q does not match generated key:\n%s", fingerprint, listing)
+	}
+
+	if _, err := importGPGKey(context.Background(), filepath.Join(root, "dst"), filepath.Join(root, "missing.asc")); err == nil {
+		t.Errorf("expected error for missing key file")
+	}
+}
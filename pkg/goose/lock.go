@@ -0,0 +1,126 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// LockPolicy は同じセッションが既に実行中の場合の振る舞いです
+type LockPolicy string
+
+const (
+	// LockPolicyReject は実行中のセッションがあればエラーを返します
+	LockPolicyReject LockPolicy = "reject"
+	// LockPolicyWait は実行中のセッションが終了するまで待ちます
+	LockPolicyWait LockPolicy = "wait"
+	// LockPolicyRestart は実行中のセッションをキャンセルし、新しい指示で実行し直します
+	LockPolicyRestart LockPolicy = "restart"
+)
+
+var (
+	// ErrSessionLocked は LockPolicyReject で同じセッションが実行中の場合のエラーです
+	ErrSessionLocked = errors.New("session is already running")
+	// ErrSessionRestarted は LockPolicyRestart により実行がキャンセルされた場合の原因です
+	ErrSessionRestarted = errors.New("session was restarted by a newer request")
+)
+
+// lockPollInterval は別プロセスが保持するロックの解放を待つ間隔です
+const lockPollInterval = time.Second
+
+// ParseLockPolicy は設定値を LockPolicy に変換します
+func ParseLockPolicy(s string) (LockPolicy, error) {
+	switch p := LockPolicy(s); p {
+	case LockPolicyReject, LockPolicyWait, LockPolicyRestart:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown session lock policy: %q", s)
+}
+
+type heldSession struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// SessionLocker はセッション単位の実行をプロセス内のマップとセッションディレクトリの
+// ファイルロックの両方で排他します
+type SessionLocker struct {
+	mu   sync.Mutex
+	held map[string]*heldSession
+}
+
+// NewSessionLocker は新しい SessionLocker を作成します
+func NewSessionLocker() *SessionLocker {
+	return &SessionLocker{held: make(map[string]*heldSession)}
+}
+
+// sessionLocks はリクエストごとに作られる GooseAgent 間で共有されます
+var sessionLocks = NewSessionLocker()
+
+// Acquire は sessionDir のロックを取得し、実行に使うコンテキストと解放関数を返します
+// 返されたコンテキストは LockPolicyRestart で後続のリクエストが来た場合にキャンセルされます
+// 別プロセスがロックを保持している場合はキャンセルできないため、restart は wait と同じ振る舞いになります
+func (l *SessionLocker) Acquire(ctx context.Context, sessionDir string, policy LockPolicy) (context.Context, func(), error) {
+	for {
+		l.mu.Lock()
+		if current, ok := l.held[sessionDir]; ok {
+			l.mu.Unlock()
+			switch policy {
+			case LockPolicyReject:
+				return nil, nil, ErrSessionLocked
+			case LockPolicyRestart:
+				log.Printf("Cancelling running session to restart: %s", sessionDir)
+				current.cancel(ErrSessionRestarted)
+			}
+			select {
+			case <-current.done:
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+
+		f, err := session.TryLock(sessionDir)
+		if err != nil {
+			l.mu.Unlock()
+			if !errors.Is(err, session.ErrLocked) {
+				return nil, nil, err
+			}
+			if policy == LockPolicyReject {
+				return nil, nil, ErrSessionLocked
+			}
+			select {
+			case <-time.After(lockPollInterval):
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+
+		runCtx, cancel := context.WithCancelCause(ctx)
+		held := &heldSession{cancel: cancel, done: make(chan struct{})}
+		l.held[sessionDir] = held
+		l.mu.Unlock()
+
+		var once sync.Once
+		release := func() {
+			once.Do(func() {
+				l.mu.Lock()
+				delete(l.held, sessionDir)
+				l.mu.Unlock()
+				if err := f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+					log.Printf("Failed to release session lock: %v", err)
+				}
+				cancel(nil)
+				close(held.done)
+			})
+		}
+		return runCtx, release, nil
+	}
+}
@@ -0,0 +1,116 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+func TestSessionLockerReject(t *testing.T) {
+	l := NewSessionLocker()
+	dir := t.TempDir()
+
+	_, release, err := l.Acquire(context.Background(), dir, LockPolicyReject)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if !session.IsLocked(dir) {
+		t.Errorf("session directory is not file-locked while held")
+	}
+	if _, _, err := l.Acquire(context.Background(), dir, LockPolicyReject); !errors.Is(err, ErrSessionLocked) {
+		t.Errorf("second Acquire error = %v, expected ErrSessionLocked", err)
+	}
+	release()
+	if session.IsLocked(dir) {
+		t.Errorf("session directory is still locked after release")
+	}
+
+	_, release, err = l.Acquire(context.Background(), dir, LockPolicyReject)
+	if err != nil {
+		t.Fatalf("Acquire after release failed: %v", err)
+	}
+	release()
+}
+
+func TestSessionLockerWait(t *testing.T) {
+	l := NewSessionLocker()
+	dir := t.TempDir()
+
+	_, release, err := l.Acquire(context.Background(), dir, LockPolicyWait)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		_, release2, err := l.Acquire(context.Background(), dir, LockPolicyWait)
+		if err != nil {
+			t.Errorf("waiting Acquire failed: %v", err)
+			return
+		}
+		close(acquired)
+		release2()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("second Acquire did not wait for the first release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second Acquire did not proceed after release")
+	}
+
+	// 待機中にコンテキストがキャンセルされた場合はエラーを返す
+	_, release, err = l.Acquire(context.Background(), dir, LockPolicyWait)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := l.Acquire(ctx, dir, LockPolicyWait); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire error = %v, expected context.DeadlineExceeded", err)
+	}
+}
+
+func TestSessionLockerRestart(t *testing.T) {
+	l := NewSessionLocker()
+	dir := t.TempDir()
+
+	runCtx, release, err := l.Acquire(context.Background(), dir, LockPolicyRestart)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	// 実行中のセッションはキャンセルされたら終了する
+	go func() {
+		<-runCtx.Done()
+		release()
+	}()
+
+	_, release2, err := l.Acquire(context.Background(), dir, LockPolicyRestart)
+	if err != nil {
+		t.Fatalf("restarting Acquire failed: %v", err)
+	}
+	defer release2()
+	if !errors.Is(context.Cause(runCtx), ErrSessionRestarted) {
+		t.Errorf("cause = %v, expected ErrSessionRestarted", context.Cause(runCtx))
+	}
+}
+
+func TestParseLockPolicy(t *testing.T) {
+	for _, s := range []string{"reject", "wait", "restart"} {
+		if _, err := ParseLockPolicy(s); err != nil {
+			t.Errorf("ParseLockPolicy(%s) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseLockPolicy("unknown"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
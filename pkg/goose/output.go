@@ -0,0 +1,254 @@
+package goose
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/redact"
+)
+
+// OutputStream は出力元のストリーム (stdout / stderr) を表します
+type OutputStream string
+
+const (
+	OutputStreamStdout OutputStream = "stdout"
+	OutputStreamStderr OutputStream = "stderr"
+)
+
+// maxOutputLineBytes を超える行は分割して送出します
+const maxOutputLineBytes = 64 * 1024
+
+// OutputLine は goose の出力 1 行分を表します
+type OutputLine struct {
+	SessionID string
+	Stream    OutputStream
+	Text      string
+	Time      time.Time
+}
+
+// OutputSink は goose の出力を行単位で受け取るインターフェースです
+type OutputSink interface {
+	WriteLine(line OutputLine) error
+}
+
+// LogSink は出力行を log パッケージに書き出します
+type LogSink struct {
+	Logger *log.Logger
+}
+
+func (s *LogSink) WriteLine(line OutputLine) error {
+	if s.Logger == nil {
+		log.Printf("[%s] %s: %s", line.SessionID, line.Stream, line.Text)
+		return nil
+	}
+	s.Logger.Printf("[%s] %s: %s", line.SessionID, line.Stream, line.Text)
+	return nil
+}
+
+// FileSink は出力行をファイルに追記します
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileSink は filePath に追記する FileSink を作成します
+func NewFileSink(filePath string) (*FileSink, error) {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) WriteLine(line OutputLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.f, "%s [%s] %s\n", line.Time.Format(time.RFC3339), line.Stream, line.Text)
+	return err
+}
+
+// Close はファイルを閉じます
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// ChannelSink は出力行をチャネルに転送します
+// 受信側が詰まっている場合は実行をブロックしないよう行を破棄し、破棄数を記録します
+type ChannelSink struct {
+	C       chan OutputLine
+	mu      sync.Mutex
+	dropped int
+	closed  bool
+}
+
+// NewChannelSink はバッファサイズ size の ChannelSink を作成します
+func NewChannelSink(size int) *ChannelSink {
+	return &ChannelSink{C: make(chan OutputLine, size)}
+}
+
+func (s *ChannelSink) WriteLine(line OutputLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.C <- line:
+	default:
+		s.dropped++
+	}
+	return nil
+}
+
+// Close はチャネルを閉じ、受信側に出力の終わりを知らせます。以降の行は破棄します
+func (s *ChannelSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.C)
+	}
+	return nil
+}
+
+// Dropped は受信側が追いつかずに破棄された行数を返します
+func (s *ChannelSink) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// MultiSink は複数の OutputSink にまとめて書き出します
+type MultiSink []OutputSink
+
+func (m MultiSink) WriteLine(line OutputLine) error {
+	var errs []string
+	for _, s := range m {
+		if err := s.WriteLine(line); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to write output line: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RedactSink は出力行から秘密情報を取り除いてから Sink に渡します
+type RedactSink struct {
+	Sink     OutputSink
+	Redactor *redact.Redactor
+}
+
+func (s *RedactSink) WriteLine(line OutputLine) error {
+	line.Text = s.Redactor.String(line.Text)
+	return s.Sink.WriteLine(line)
+}
+
+// tailBuffer は最後の n 行だけを保持するリングバッファです
+// Execute の戻り値をセッションの長さに関わらず一定サイズに抑えるために使います
+type tailBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	total int
+}
+
+func newTailBuffer(n int) *tailBuffer {
+	if n <= 0 {
+		n = 1
+	}
+	return &tailBuffer{lines: make([]string, 0, n)}
+}
+
+func (b *tailBuffer) WriteLine(line OutputLine) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total++
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, line.Text)
+		return nil
+	}
+	b.lines[b.next] = line.Text
+	b.next = (b.next + 1) % len(b.lines)
+	return nil
+}
+
+// String は保持している行を古い順に連結して返します
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ordered := append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+	var sb strings.Builder
+	if omitted := b.total - len(ordered); omitted > 0 {
+		fmt.Fprintf(&sb, "... (%d lines omitted)\n", omitted)
+	}
+	for _, l := range ordered {
+		sb.WriteString(l)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// lineWriter は書き込まれたバイト列を行単位に区切って sink に送出する io.Writer です
+// exec.Cmd の Stdout/Stderr に渡すことで、Wait と WaitDelay による後始末を exec に任せられます
+type lineWriter struct {
+	sessionID string
+	stream    OutputStream
+	sink      OutputSink
+	pending   []byte
+}
+
+func newLineWriter(sessionID string, stream OutputStream, sink OutputSink) *lineWriter {
+	return &lineWriter{sessionID: sessionID, stream: stream, sink: sink}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.pending = append(w.pending, p...)
+			for len(w.pending) > maxOutputLineBytes {
+				w.emit(w.pending[:maxOutputLineBytes])
+				w.pending = append(w.pending[:0], w.pending[maxOutputLineBytes:]...)
+			}
+			break
+		}
+		w.pending = append(w.pending, p[:i]...)
+		p = p[i+1:]
+		for len(w.pending) > maxOutputLineBytes {
+			w.emit(w.pending[:maxOutputLineBytes])
+			w.pending = append(w.pending[:0], w.pending[maxOutputLineBytes:]...)
+		}
+		w.emit(bytes.TrimSuffix(w.pending, []byte("\r")))
+		w.pending = w.pending[:0]
+	}
+	return n, nil
+}
+
+// Flush は改行で終わっていない最後の行を送出します
+func (w *lineWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.emit(w.pending)
+		w.pending = w.pending[:0]
+	}
+}
+
+func (w *lineWriter) emit(text []byte) {
+	if err := w.sink.WriteLine(OutputLine{
+		SessionID: w.sessionID,
+		Stream:    w.stream,
+		Text:      string(text),
+		Time:      time.Now(),
+	}); err != nil {
+		log.Printf("Failed to write output line: %v", err)
+	}
+}
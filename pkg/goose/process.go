@@ -0,0 +1,131 @@
+package goose
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// processPollInterval はプロセスグループの終了を確認する間隔です
+const processPollInterval = 50 * time.Millisecond
+
+// processGroup は実行スクリプトを独立したプロセスグループで起動し、
+// goose と npx で起動された MCP 拡張などの子プロセスをまとめて終了させます
+//
+// コンテキストがキャンセルされるとグループ全体に SIGTERM を送り、killTimeout 経過後も
+// 残っていれば SIGKILL を送ります。Wait の後は Cleanup でグループに残ったプロセスを
+// 同じ手順で終了させ、自分の子として残ったゾンビを回収します
+type processGroup struct {
+	cmd         *exec.Cmd
+	killTimeout time.Duration
+
+	mu        sync.Mutex
+	killTimer *time.Timer
+}
+
+// newProcessGroup は cmd をプロセスグループとして起動するよう設定します
+// cmd.Start より前に呼び出す必要があります
+func newProcessGroup(cmd *exec.Cmd, killTimeout time.Duration) *processGroup {
+	g := &processGroup{cmd: cmd, killTimeout: killTimeout}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = g.terminate
+	// SIGKILL までの猶予に加えて、子プロセスが出力パイプを開いたまま残っても Wait が戻るようにする
+	cmd.WaitDelay = killTimeout + outputWaitDelay
+	return g
+}
+
+// terminate はコンテキストのキャンセル時に exec から呼び出されます
+func (g *processGroup) terminate() error {
+	pgid := g.cmd.Process.Pid
+	log.Printf("Sending SIGTERM to process group %d", pgid)
+	if err := g.signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.killTimer == nil {
+		g.killTimer = time.AfterFunc(g.killTimeout, func() {
+			log.Printf("Process group %d did not exit within %s, sending SIGKILL", pgid, g.killTimeout)
+			_ = g.signal(syscall.SIGKILL)
+		})
+	}
+	return nil
+}
+
+// Cleanup は Wait が戻った後に呼び出し、プロセスグループに残ったプロセスを終了させます
+// killTimeout の 2 倍待っても終了しない場合は諦めてログに残します
+func (g *processGroup) Cleanup() {
+	if g.cmd.Process == nil {
+		return
+	}
+	// キャンセル時の SIGKILL のタイマーは止め、以降の終了処理はここで行う
+	g.stopKillTimer()
+	if !g.alive() {
+		return
+	}
+	pgid := g.cmd.Process.Pid
+	log.Printf("Terminating leftover processes in process group %d", pgid)
+	_ = g.signal(syscall.SIGTERM)
+	if g.waitExit(g.killTimeout) {
+		return
+	}
+	log.Printf("Process group %d did not exit within %s, sending SIGKILL", pgid, g.killTimeout)
+	_ = g.signal(syscall.SIGKILL)
+	if !g.waitExit(g.killTimeout) {
+		log.Printf("Process group %d is still alive after SIGKILL", pgid)
+	}
+}
+
+func (g *processGroup) stopKillTimer() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.killTimer != nil {
+		g.killTimer.Stop()
+	}
+}
+
+// waitExit はプロセスグループが終了するまで最大 timeout 待ち、終了したかどうかを返します
+func (g *processGroup) waitExit(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for g.alive() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(processPollInterval)
+	}
+	return true
+}
+
+// alive はプロセスグループにプロセスが残っているかどうかを返します
+// 親が先に終了して自分の子として引き取ったプロセス (PID 1 として動いている場合など) は
+// ここでゾンビを回収しないとグループから消えないため、先に回収します
+func (g *processGroup) alive() bool {
+	g.reap()
+	return syscall.Kill(-g.cmd.Process.Pid, 0) == nil
+}
+
+// reap はプロセスグループ内の終了済みの子プロセスを回収します
+// リーダー自身は exec が回収するため、Wait の前には呼び出さないでください
+func (g *processGroup) reap() {
+	if g.cmd.ProcessState == nil {
+		return
+	}
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-g.cmd.Process.Pid, &status, syscall.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return
+		}
+	}
+}
+
+func (g *processGroup) signal(sig syscall.Signal) error {
+	err := syscall.Kill(-g.cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
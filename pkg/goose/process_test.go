@@ -0,0 +1,127 @@
+package goose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processExited はプロセスが終了している (存在しないかゾンビになっている) かどうかを返します
+func processExited(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return true
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	// "pid (comm) state ..." の state を確認する
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// readPids はスクリプトが書き出した子プロセスの PID を読み込みます
+func readPids(t *testing.T, pidFile string, n int) []int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(pidFile)
+		if err == nil {
+			var pids []int
+			for _, f := range strings.Fields(string(data)) {
+				var pid int
+				if _, err := fmt.Sscanf(f, "%d", &pid); err == nil {
+					pids = append(pids, pid)
+				}
+			}
+			if len(pids) >= n {
+				return pids
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("child processes did not start")
+	return nil
+}
+
+func TestProcessGroup(t *testing.T) {
+	testCases := []struct {
+		name string
+		// script は子プロセスの PID を $PIDFILE に書き出す
+		script      string
+		children    int
+		cancel      bool
+		killTimeout time.Duration
+		// 終了までにかかる時間の上限
+		maxElapsed time.Duration
+	}{
+		{
+			name:        "キャンセル時に SIGTERM で子プロセスごと終了する",
+			script:      `sleep 60 >/dev/null 2>&1 & echo $! >> "$PIDFILE"; sleep 60 >/dev/null 2>&1 & echo $! >> "$PIDFILE"; wait`,
+			children:    2,
+			cancel:      true,
+			killTimeout: 10 * time.Second,
+			maxElapsed:  5 * time.Second,
+		},
+		{
+			name:        "SIGTERM を無視する子プロセスは SIGKILL で終了する",
+			script:      `(trap '' TERM; exec sleep 60) >/dev/null 2>&1 & echo $! >> "$PIDFILE"; wait`,
+			children:    1,
+			cancel:      true,
+			killTimeout: 200 * time.Millisecond,
+			maxElapsed:  5 * time.Second,
+		},
+		{
+			name:        "正常終了後に残った子プロセスを終了する",
+			script:      `sleep 60 >/dev/null 2>&1 & echo $! >> "$PIDFILE"; exit 0`,
+			children:    1,
+			killTimeout: 200 * time.Millisecond,
+			maxElapsed:  5 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pidFile := filepath.Join(t.TempDir(), "children.pid")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cmd := exec.CommandContext(ctx, "bash", "-c", tc.script)
+			cmd.Env = append(os.Environ(), "PIDFILE="+pidFile)
+			group := newProcessGroup(cmd, tc.killTimeout)
+			start := time.Now()
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("Failed to start command: %v", err)
+			}
+			pids := readPids(t, pidFile, tc.children)
+
+			if tc.cancel {
+				cancel()
+			}
+			_ = cmd.Wait()
+			group.Cleanup()
+			if elapsed := time.Since(start); elapsed > tc.maxElapsed {
+				t.Errorf("process group took %s to exit, expected at most %s", elapsed, tc.maxElapsed)
+			}
+
+			for _, pid := range pids {
+				deadline := time.Now().Add(5 * time.Second)
+				for !processExited(pid) {
+					if time.Now().After(deadline) {
+						t.Fatalf("child process %d is still alive", pid)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if syscall.Kill(-cmd.Process.Pid, 0) == nil && !processExited(cmd.Process.Pid) {
+				t.Errorf("process group %d still has members", cmd.Process.Pid)
+			}
+		})
+	}
+}
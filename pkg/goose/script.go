@@ -0,0 +1,198 @@
+package goose
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+//go:embed templates/goose-execute.sh.tmpl
+var defaultScriptTemplate string
+
+// ResumePolicy は実行スクリプトが goose の既存セッションをどう扱うかを表します
+type ResumePolicy string
+
+const (
+	// ResumePolicyResume は既存のセッションの再開を試み、再開できなければ新しく開始します
+	ResumePolicyResume ResumePolicy = "resume"
+	// ResumePolicyNew は常に新しいセッションとして開始します
+	ResumePolicyNew ResumePolicy = "new"
+)
+
+// ParseResumePolicy は設定値を ResumePolicy に変換します
+func ParseResumePolicy(s string) (ResumePolicy, error) {
+	switch p := ResumePolicy(s); p {
+	case ResumePolicyResume, ResumePolicyNew:
+		return p, nil
+	case "":
+		return ResumePolicyResume, nil
+	}
+	return "", fmt.Errorf("unknown resume policy: %s", s)
+}
+
+// ScriptExtension は goose に渡す MCP 拡張です
+// Command と Env の値は実行時に展開されるため $GITHUB_TOKEN などの環境変数を参照できます
+type ScriptExtension struct {
+	Name    string
+	Command string
+	// Env は KEY=VALUE 形式の環境変数です
+	Env []string
+	// Timeout が 0 の拡張は --with-extension で、それ以外は goose の設定 (GooseExtensionsConfig) で渡します
+	Timeout time.Duration
+}
+
+// Arg は --with-extension に渡す "KEY=VALUE ... command" 形式の文字列を返します
+func (e ScriptExtension) Arg() string {
+	return strings.Join(append(append([]string{}, e.Env...), e.Command), " ")
+}
+
+// gooseExtension は goose の設定の extensions の 1 エントリ (stdio の拡張) です
+type gooseExtension struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Enabled     bool              `json:"enabled"`
+	Cmd         string            `json:"cmd"`
+	Args        []string          `json:"args"`
+	Envs        map[string]string `json:"envs"`
+	Description string            `json:"description"`
+	Timeout     int64             `json:"timeout"`
+}
+
+// GooseExtensionsConfig は Timeout を指定した拡張を goose の設定の extensions の形式 (JSON) で返します
+// goose run の --with-extension はタイムアウトを受け付けないため、goose が設定より優先する環境変数
+// EXTENSIONS で渡します。該当する拡張がなければ空文字を返します
+// 値の $VAR は --with-extension と同様に実行スクリプトで展開されます
+func GooseExtensionsConfig(extensions []ScriptExtension) (string, error) {
+	config := make(map[string]gooseExtension)
+	for _, e := range extensions {
+		if e.Timeout <= 0 {
+			continue
+		}
+		fields := strings.Fields(e.Command)
+		if len(fields) == 0 {
+			return "", fmt.Errorf("extension %s: command is required", e.Name)
+		}
+		envs := make(map[string]string, len(e.Env))
+		for _, kv := range e.Env {
+			k, v, _ := strings.Cut(kv, "=")
+			envs[k] = v
+		}
+		config[e.Name] = gooseExtension{
+			Type:    "stdio",
+			Name:    e.Name,
+			Enabled: true,
+			Cmd:     fields[0],
+			Args:    fields[1:],
+			Envs:    envs,
+			// goose のタイムアウトは秒単位
+			Timeout: int64((e.Timeout + time.Second - 1) / time.Second),
+		}
+	}
+	if len(config) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode extensions config: %w", err)
+	}
+	return string(data), nil
+}
+
+// ScriptParams は実行スクリプトのテンプレートに渡すパラメータです
+type ScriptParams struct {
+	// EnvFilePath は source する env ファイルです (空の場合、環境変数は子プロセスに直接渡されます)
+	EnvFilePath string
+	// RepoDir は準備済みの作業ディレクトリです
+	RepoDir    string
+	Builtins   []string
+	Extensions []ScriptExtension
+	// ExtensionsConfig は GooseExtensionsConfig の値です (空の場合は設定しません)
+	ExtensionsConfig string
+	ResumePolicy     ResumePolicy
+	MaxAttempts      int
+	// ExhaustedExitCode は MaxAttempts 回失敗したときの終了コードです
+	ExhaustedExitCode int
+}
+
+var scriptFuncs = template.FuncMap{
+	"quote":   shellQuote,
+	"expand":  shellEscapeDoubleQuoted,
+	"heredoc": shellEscapeHeredoc,
+}
+
+// RenderScript は params で実行スクリプトを生成します
+// templatePath が空の場合は埋め込みのテンプレートを使用します
+func RenderScript(templatePath string, params ScriptParams) (string, error) {
+	text := defaultScriptTemplate
+	if templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read script template: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("goose-execute.sh").Funcs(scriptFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse script template: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, params); err != nil {
+		return "", fmt.Errorf("failed to render script template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// shellQuote は s を POSIX シェルのシングルクォートで囲んだ文字列を返します
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// shellEscapeDoubleQuoted は s をダブルクォート内に埋め込めるようエスケープします
+// $ はエスケープしないため、環境変数は実行時に展開されます
+func shellEscapeDoubleQuoted(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`").Replace(s)
+}
+
+// shellEscapeHeredoc は s を区切りをクォートしないヒアドキュメントに埋め込めるようエスケープします
+// $ はエスケープしないため、環境変数は実行時に展開されます
+func shellEscapeHeredoc(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s)
+}
+
+// repoURL は認証情報を含まないリポジトリの URL を返します
+func (a *GooseAgent) repoURL() string {
+	return a.host.RepoURL(a.Opts.GitHub.GetRepo())
+}
+
+// scriptParams は実行スクリプトのテンプレートに渡すパラメータを組み立てます
+func (a *GooseAgent) scriptParams(envFilePath string, budget Budget) (ScriptParams, error) {
+	resume, err := ParseResumePolicy(a.cfg.GetResumePolicy())
+	if err != nil {
+		return ScriptParams{}, err
+	}
+	extensions, err := ResolveExtensions(a.cfg, a.Opts.GitHub.GetRepo(), a.Opts.Provider)
+	if err != nil {
+		return ScriptParams{}, err
+	}
+	extensionsConfig, err := GooseExtensionsConfig(extensions)
+	if err != nil {
+		return ScriptParams{}, err
+	}
+	return ScriptParams{
+		EnvFilePath:       envFilePath,
+		RepoDir:           filepath.Join(a.sessionDir(), session.RepoDirName),
+		Builtins:          a.cfg.GetBuiltins(),
+		Extensions:        extensions,
+		ExtensionsConfig:  extensionsConfig,
+		ResumePolicy:      resume,
+		MaxAttempts:       budget.MaxAttempts,
+		ExhaustedExitCode: attemptsExhaustedExitCode,
+	}, nil
+}
@@ -0,0 +1,220 @@
+package goose
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "testdata のゴールデンファイルを更新する")
+
+func TestRenderScript(t *testing.T) {
+	base := ScriptParams{
+		EnvFilePath: "/sessions/org-repo-issues-1/env",
+		RepoDir:     "/sessions/org-repo-issues-1/repo",
+		Builtins:    []string{"developer"},
+		Extensions: []ScriptExtension{
+			{Name: "github", Command: "mise exec -- npx -y @modelcontextprotocol/server-github", Env: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN"}},
+			{Name: "memory-bank", Command: "mise exec -- npx -y @allpepper/memory-bank-mcp", Env: []string{"MEMORY_BANK_ROOT=$HOME/.kommon/memory"}},
+			{Name: "sequential-thinking", Command: "mise exec -- npx -y @modelcontextprotocol/server-sequential-thinking"},
+		},
+		ResumePolicy:      ResumePolicyResume,
+		MaxAttempts:       1,
+		ExhaustedExitCode: attemptsExhaustedExitCode,
+	}
+
+	testCases := []struct {
+		name   string
+		golden string
+		modify func(p *ScriptParams)
+	}{
+		{
+			name:   "デフォルト",
+			golden: "default.sh.golden",
+			modify: func(p *ScriptParams) {},
+		},
+		{
+			name:   "新規セッションを最大 3 回",
+			golden: "new-session.sh.golden",
+			modify: func(p *ScriptParams) {
+				p.ResumePolicy = ResumePolicyNew
+				p.MaxAttempts = 3
+			},
+		},
+		{
+			name:   "env ファイルを使わない (process モード)",
+			golden: "process-env.sh.golden",
+			modify: func(p *ScriptParams) {
+				p.EnvFilePath = ""
+			},
+		},
+		{
+			name:   "タイムアウトを指定した拡張",
+			golden: "extension-timeout.sh.golden",
+			modify: func(p *ScriptParams) {
+				p.Extensions = append([]ScriptExtension{}, p.Extensions...)
+				p.Extensions[0].Timeout = 10 * time.Minute
+				config, err := GooseExtensionsConfig(p.Extensions)
+				if err != nil {
+					t.Fatalf("GooseExtensionsConfig failed: %v", err)
+				}
+				p.ExtensionsConfig = config
+			},
+		},
+		{
+			name:   "特殊文字を含む値のクォート",
+			golden: "quoting.sh.golden",
+			modify: func(p *ScriptParams) {
+				p.RepoDir = `/sessions/O'Brien "$(rm -rf /)"/repo`
+				p.Builtins = []string{"developer", "it's `id`"}
+				p.Extensions = []ScriptExtension{{Name: "custom", Command: `my-mcp --label "a b"`, Env: []string{"TOKEN=$GITHUB_TOKEN"}}}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := base
+			tc.modify(&params)
+			got, err := RenderScript("", params)
+			if err != nil {
+				t.Fatalf("RenderScript failed: %v", err)
+			}
+
+			// 生成されたスクリプトが bash の構文として正しいこと
+			check := exec.Command("bash", "-n")
+			check.Stdin = strings.NewReader(got)
+			if out, err := check.CombinedOutput(); err != nil {
+				t.Fatalf("rendered script has syntax errors: %v\n%s", err, out)
+			}
+
+			goldenPath := filepath.Join("testdata", tc.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if got != string(expected) {
+				t.Errorf("rendered script does not match %s (run with -update to regenerate)\n--- got ---\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// TestGooseExtensionsConfigExpand は実行スクリプトで展開した EXTENSIONS が goose の設定として読めることを確認します
+func TestGooseExtensionsConfigExpand(t *testing.T) {
+	config, err := GooseExtensionsConfig([]ScriptExtension{
+		{Name: "github", Command: "npx -y server-github", Env: []string{"GITHUB_PERSONAL_ACCESS_TOKEN=$GITHUB_TOKEN"}, Timeout: 90 * time.Second},
+		{Name: "memory-bank", Command: "npx memory-bank"},
+		{Name: "quoted", Command: `my-mcp --pattern a\b`, Timeout: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("GooseExtensionsConfig failed: %v", err)
+	}
+	script := "cat <<GOOSE_EXTENSIONS\n" + shellEscapeHeredoc(config) + "\nGOOSE_EXTENSIONS\n"
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Env = []string{"GITHUB_TOKEN=ghs_token"}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to expand config: %v", err)
+	}
+	var got map[string]gooseExtension
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("expanded config is not JSON: %v\n%s", err, out)
+	}
+	want := map[string]gooseExtension{
+		"github": {Type: "stdio", Name: "github", Enabled: true, Cmd: "npx", Args: []string{"-y", "server-github"},
+			Envs: map[string]string{"GITHUB_PERSONAL_ACCESS_TOKEN": "ghs_token"}, Timeout: 90},
+		"quoted": {Type: "stdio", Name: "quoted", Enabled: true, Cmd: "my-mcp", Args: []string{"--pattern", `a\b`},
+			Envs: map[string]string{}, Timeout: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %+v, want %+v", got, want)
+	}
+}
+
+// TestRenderScriptExitCode は goose が失敗したときのスクリプトの終了コードを確認します
+func TestRenderScriptExitCode(t *testing.T) {
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "goose"), []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake goose: %v", err)
+	}
+	testCases := []struct {
+		name        string
+		maxAttempts int
+		want        int
+	}{
+		{name: "1 回だけ実行する場合は goose の終了コード", maxAttempts: 1, want: 3},
+		{name: "回数を使い切った場合", maxAttempts: 2, want: attemptsExhaustedExitCode},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			script, err := RenderScript("", ScriptParams{
+				RepoDir:           t.TempDir(),
+				ResumePolicy:      ResumePolicyNew,
+				MaxAttempts:       tc.maxAttempts,
+				ExhaustedExitCode: attemptsExhaustedExitCode,
+			})
+			if err != nil {
+				t.Fatalf("RenderScript failed: %v", err)
+			}
+			cmd := exec.Command("bash", "-c", script)
+			cmd.Env = []string{"PATH=" + binDir + ":/usr/bin:/bin"}
+			err = cmd.Run()
+			if cmd.ProcessState == nil || cmd.ProcessState.ExitCode() != tc.want {
+				t.Errorf("exit code = %v (%v), want %d", cmd.ProcessState, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderScriptTemplatePath(t *testing.T) {
+	tempDir := t.TempDir()
+	templatePath := filepath.Join(tempDir, "custom.sh.tmpl")
+	if err := os.WriteFile(templatePath, []byte("#!/bin/bash\necho {{ quote .RepoDir }} {{ .MaxAttempts }}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	got, err := RenderScript(templatePath, ScriptParams{RepoDir: "/sessions/a b/repo", MaxAttempts: 2})
+	if err != nil {
+		t.Fatalf("RenderScript failed: %v", err)
+	}
+	if expected := "#!/bin/bash\necho '/sessions/a b/repo' 2\n"; got != expected {
+		t.Errorf("RenderScript = %q, expected %q", got, expected)
+	}
+
+	if _, err := RenderScript(filepath.Join(tempDir, "missing.tmpl"), ScriptParams{}); err == nil {
+		t.Errorf("expected error for missing template")
+	}
+	if err := os.WriteFile(templatePath, []byte("{{ .Unknown }}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if _, err := RenderScript(templatePath, ScriptParams{}); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func TestParseResumePolicy(t *testing.T) {
+	for input, expected := range map[string]ResumePolicy{
+		"":       ResumePolicyResume,
+		"resume": ResumePolicyResume,
+		"new":    ResumePolicyNew,
+	} {
+		if got, err := ParseResumePolicy(input); err != nil || got != expected {
+			t.Errorf("ParseResumePolicy(%q) = %s, %v, expected %s", input, got, err, expected)
+		}
+	}
+	if _, err := ParseResumePolicy("always"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
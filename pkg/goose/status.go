@@ -0,0 +1,331 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/redact"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// StatusCommentMarker は進捗のコメントを他のコメントと区別するための HTML コメントです
+const StatusCommentMarker = "<!-- goose-connect:status -->"
+
+// TaskStatus は issue/PR に報告するタスクの状態です
+type TaskStatus string
+
+const (
+	TaskStatusQueued    TaskStatus = "queued"
+	TaskStatusRunning   TaskStatus = "running"
+	TaskStatusSucceeded TaskStatus = "succeeded"
+	TaskStatusFailed    TaskStatus = "failed"
+)
+
+// StatusReporter はタスクの状態を issue/PR のラベルと、状態が変わるたびに編集する 1 つのコメントで報告する Hook です
+type StatusReporter struct {
+	NopHook
+
+	Labels config.StatusLabels
+	// Comment が false の場合はラベルだけを付け替えます
+	Comment bool
+	// ExcerptLines は完了時のコメントに載せるトランスクリプトの末尾の行数です
+	ExcerptLines int
+	// BaseDir は完了時にトランスクリプトを読むセッションの保存先です
+	BaseDir string
+	// Checks が true の場合、PR のタスクは head のコミットのチェックランでも報告します
+	Checks bool
+	// CheckName はチェックランの名前です
+	CheckName string
+	// ProgressInterval はチェックランに実行中の出力を反映する最短の間隔です (0 の場合は 30 秒)
+	ProgressInterval time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	reports map[*proto.ExecuteTaskRequest]*statusReport
+}
+
+// statusReport は 1 つのタスクの報告の状態です
+type statusReport struct {
+	mu        sync.Mutex
+	commentID int64
+	status    TaskStatus
+	queuedAt  time.Time
+	startedAt time.Time
+	err       error
+	result    *TaskResult
+	// run はこのタスクの実行記録です (完了時に設定します)
+	run *session.Run
+	// checkRunID と headSHA はチェックランで報告する場合に設定します
+	checkRunID int64
+	headSHA    string
+
+	// outMu は出力の末尾と途中経過の報告の状態を守ります
+	// 出力の受け取りが mu を持つ API 呼び出しを待たないよう、mu とは分けています
+	outMu        sync.Mutex
+	outTail      []string
+	lastProgress time.Time
+	progressing  bool
+}
+
+// NewStatusReporter は設定から StatusReporter を作成します
+func NewStatusReporter(cfg *config.Config) *StatusReporter {
+	return &StatusReporter{
+		Labels:       cfg.GetStatusLabels(),
+		Comment:      cfg.GetStatusComment(),
+		ExcerptLines: cfg.GetStatusExcerptLines(),
+		BaseDir:      sessionBaseDir(cfg),
+		Checks:       cfg.GetCheckRun(),
+		CheckName:    cfg.GetCheckRunName(),
+	}
+}
+
+// report は msg の報告の状態を返します。create が false で存在しなければ nil を返します
+func (r *StatusReporter) report(msg *proto.ExecuteTaskRequest, create bool) *statusReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rep, ok := r.reports[msg]; ok || !create {
+		return rep
+	}
+	if r.reports == nil {
+		r.reports = make(map[*proto.ExecuteTaskRequest]*statusReport)
+	}
+	rep := &statusReport{}
+	r.reports[msg] = rep
+	return rep
+}
+
+func (r *StatusReporter) timeNow() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// OnQueued はタスクがキューに入ったことを報告します。既に開始している場合は何もしません
+func (r *StatusReporter) OnQueued(ctx context.Context, task *TaskInfo) error {
+	rep := r.report(task.Request, true)
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if rep.status != "" {
+		return nil
+	}
+	rep.status = TaskStatusQueued
+	rep.queuedAt = r.timeNow()
+	return r.publish(ctx, task, rep, "")
+}
+
+// OnStart はタスクの実行が始まったことを報告します
+func (r *StatusReporter) OnStart(ctx context.Context, task *TaskInfo) error {
+	rep := r.report(task.Request, true)
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.status = TaskStatusRunning
+	rep.startedAt = r.timeNow()
+	rep.outMu.Lock()
+	rep.lastProgress = rep.startedAt
+	rep.outMu.Unlock()
+	return r.publish(ctx, task, rep, "")
+}
+
+// OnFinally はタスクの結果 (終了コード、経過時間、トランスクリプトの末尾) を報告し、タスクの報告を終えます
+func (r *StatusReporter) OnFinally(ctx context.Context, task *TaskInfo, result *TaskResult) error {
+	msg := task.Request
+	rep := r.report(msg, true)
+	defer func() {
+		r.mu.Lock()
+		delete(r.reports, msg)
+		r.mu.Unlock()
+	}()
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	run := result.Run
+	rep.run = run
+	rep.err = result.Err
+	rep.result = result
+	rep.status = TaskStatusSucceeded
+	if rep.err != nil || (run != nil && run.Status != session.RunStatusSucceeded) {
+		rep.status = TaskStatusFailed
+	}
+	var summary string
+	if r.Comment || r.Checks {
+		summary = r.summary(msg, rep, run)
+	}
+	return r.publish(ctx, task, rep, summary)
+}
+
+// publish は状態のラベルを付け替え、進捗のコメントを作成または編集します
+func (r *StatusReporter) publish(ctx context.Context, task *TaskInfo, rep *statusReport, summary string) error {
+	msg := task.Request
+	num, err := prOrIssueNumber(msg.GetGithub())
+	if err != nil {
+		return err
+	}
+	client, err := task.GitHub(ctx)
+	if err != nil {
+		return err
+	}
+	owner, repo := splitRepo(msg.GetGithub().GetRepo())
+	var errs []error
+	if err := r.setLabel(ctx, client, owner, repo, num, rep.status); err != nil {
+		errs = append(errs, err)
+	}
+	if r.Checks && msg.GetGithub().GetPrNumber() > 0 {
+		if err := r.publishCheck(ctx, client, owner, repo, num, msg, rep, summary); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if r.Comment {
+		body := r.render(msg, rep, summary)
+		if rep.commentID == 0 {
+			comment, _, err := client.Issues.CreateComment(ctx, owner, repo, num, &github.IssueComment{Body: github.String(body)})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to create status comment: %w", err))
+			} else {
+				rep.commentID = comment.GetID()
+			}
+		} else if _, _, err := client.Issues.EditComment(ctx, owner, repo, rep.commentID, &github.IssueComment{Body: github.String(body)}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to edit status comment: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// label は status に対応するラベルを返します
+func (r *StatusReporter) label(status TaskStatus) string {
+	switch status {
+	case TaskStatusQueued:
+		return r.Labels.Queued
+	case TaskStatusRunning:
+		return r.Labels.Running
+	case TaskStatusSucceeded:
+		return r.Labels.Succeeded
+	case TaskStatusFailed:
+		return r.Labels.Failed
+	}
+	return ""
+}
+
+// setLabel は status のラベルを付け、他の状態のラベルを外します
+// 以前の実行で付いたラベルも外すため、付いていないラベルの削除 (404) は無視します
+func (r *StatusReporter) setLabel(ctx context.Context, client *github.Client, owner, repo string, num int, status TaskStatus) error {
+	want := r.label(status)
+	var errs []error
+	for _, s := range []TaskStatus{TaskStatusQueued, TaskStatusRunning, TaskStatusSucceeded, TaskStatusFailed} {
+		label := r.label(s)
+		if label == "" || label == want {
+			continue
+		}
+		resp, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, num, label)
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			errs = append(errs, fmt.Errorf("failed to remove label %s: %w", label, err))
+		}
+	}
+	if want != "" {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, num, []string{want}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add label %s: %w", want, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// statusTitles はコメントの見出しに使う状態の表示です
+var statusTitles = map[TaskStatus]string{
+	TaskStatusQueued:    "待機中 (queued)",
+	TaskStatusRunning:   "実行中 (running)",
+	TaskStatusSucceeded: "完了 (succeeded)",
+	TaskStatusFailed:    "失敗 (failed)",
+}
+
+// render は進捗のコメントの本文を返します
+func (r *StatusReporter) render(msg *proto.ExecuteTaskRequest, rep *statusReport, summary string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n### goose-connect: %s\n\n", StatusCommentMarker, statusTitles[rep.status])
+	sb.WriteString(r.details(msg, rep))
+	sb.WriteString(summary)
+	return sb.String()
+}
+
+// details はセッション、モデル、時刻の表を返します
+func (r *StatusReporter) details(msg *proto.ExecuteTaskRequest, rep *statusReport) string {
+	var sb strings.Builder
+	sb.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&sb, "| セッション | `%s` |\n", msg.GetSessionId())
+	if model := msg.GetProvider().GetModelName(); model != "" {
+		fmt.Fprintf(&sb, "| モデル | `%s` (%s) |\n", model, msg.GetProvider().GetProviderName())
+	}
+	if !rep.queuedAt.IsZero() {
+		fmt.Fprintf(&sb, "| 受付 | %s |\n", rep.queuedAt.Format(time.RFC3339))
+	}
+	if !rep.startedAt.IsZero() {
+		fmt.Fprintf(&sb, "| 開始 | %s |\n", rep.startedAt.Format(time.RFC3339))
+		if rep.result != nil {
+			fmt.Fprintf(&sb, "| 経過時間 | %s |\n", rep.result.Duration.Round(time.Second))
+		}
+	}
+	return sb.String()
+}
+
+// summary は完了時に載せる終了コード、エラー、トランスクリプトの末尾を返します
+func (r *StatusReporter) summary(msg *proto.ExecuteTaskRequest, rep *statusReport, run *session.Run) string {
+	// エラーやトランスクリプトにはリクエストの秘密情報が含まれることがある
+	redactor := redact.New(msg.GetGithub().GetApiToken(), msg.GetProvider().GetApiKey())
+	var sb strings.Builder
+	if run != nil {
+		fmt.Fprintf(&sb, "| 実行 | #%d (%s) |\n", run.Number, run.Status)
+	}
+	if res := rep.result; res != nil {
+		fmt.Fprintf(&sb, "| 終了コード | %d |\n", res.ExitCode)
+		if len(res.ChangedFiles) > 0 {
+			fmt.Fprintf(&sb, "| 変更されたファイル | %d |\n", len(res.ChangedFiles))
+		}
+	}
+	var errText string
+	switch {
+	case rep.err != nil:
+		errText = rep.err.Error()
+	case run != nil:
+		errText = run.Error
+	}
+	if errText != "" {
+		sb.WriteString("\n" + codeBlock("エラー", redactor.String(errText)))
+	}
+	if run != nil && r.ExcerptLines > 0 {
+		path := filepath.Join(session.RunDir(session.Dir(r.BaseDir, msg.GetSessionId()), run.Number), session.TranscriptFileName)
+		if data, err := os.ReadFile(path); err == nil {
+			if excerpt := tailLines(string(data), r.ExcerptLines); excerpt != "" {
+				sb.WriteString("\n" + codeBlock(fmt.Sprintf("トランスクリプトの末尾 %d 行", r.ExcerptLines), redactor.String(excerpt)))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// tailLines は s の末尾 n 行を返します
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeBlock は s を折りたたみのコードブロックにします
+// s に含まれるバッククォートの連続より長いフェンスで囲みます
+func codeBlock(title, s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("<details><summary>%s</summary>\n\n%s\n%s\n%s\n\n</details>\n", title, fence, s, fence)
+}
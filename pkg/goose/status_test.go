@@ -0,0 +1,197 @@
+package goose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/githubhost"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// fakeIssues は issue のラベルとコメントの API を記録する httptest サーバーです
+type fakeIssues struct {
+	mu       sync.Mutex
+	labels   map[string]bool
+	comments map[int64]string
+	created  int
+}
+
+func newFakeIssues(t *testing.T) (*fakeIssues, *httptest.Server) {
+	t.Helper()
+	f := &fakeIssues{labels: map[string]bool{}, comments: map[int64]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/org/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		var labels []string
+		_ = json.NewDecoder(r.Body).Decode(&labels)
+		f.mu.Lock()
+		for _, l := range labels {
+			f.labels[l] = true
+		}
+		f.mu.Unlock()
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("DELETE /api/v3/repos/org/repo/issues/7/labels/{label}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.labels[r.PathValue("label")] {
+			http.Error(w, `{"message":"Label does not exist"}`, http.StatusNotFound)
+			return
+		}
+		delete(f.labels, r.PathValue("label"))
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/org/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		var c struct{ Body string }
+		_ = json.NewDecoder(r.Body).Decode(&c)
+		f.mu.Lock()
+		f.created++
+		id := int64(100 + f.created)
+		f.comments[id] = c.Body
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id})
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/org/repo/issues/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var c struct{ Body string }
+		_ = json.NewDecoder(r.Body).Decode(&c)
+		f.mu.Lock()
+		if r.PathValue("id") == "101" {
+			f.comments[101] = c.Body
+		}
+		f.mu.Unlock()
+		_, _ = w.Write([]byte(`{"id":101}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestStatusReporter(t *testing.T) {
+	issues, srv := newFakeIssues(t)
+	host, err := githubhost.New(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	client := host.NewClient(srv.Client(), "ghs_token")
+
+	baseDir := t.TempDir()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := &StatusReporter{
+		Labels:       config.StatusLabels{Queued: "goose-queued", Running: "goose-running", Succeeded: "goose-succeeded", Failed: "goose-failed"},
+		Comment:      true,
+		ExcerptLines: 2,
+		BaseDir:      baseDir,
+		now:          func() time.Time { return now },
+	}
+	msg := &proto.ExecuteTaskRequest{
+		SessionId: "org-repo-7",
+		Provider:  &proto.ProviderInfo{ProviderName: "openai", ModelName: "gpt-4o", ApiKey: "sk-secret-api-key"},
+		Github:    &proto.GitHubInfo{ApiToken: "ghs_token", Repo: "org/repo", IssueNumber: 7},
+	}
+	ctx := context.Background()
+	task := &TaskInfo{Request: msg, client: func(context.Context) (*github.Client, error) { return client, nil }}
+
+	if err := r.OnQueued(ctx, task); err != nil {
+		t.Fatalf("OnQueued failed: %v", err)
+	}
+	if !issues.labels["goose-queued"] || issues.created != 1 || !strings.Contains(issues.comments[101], "待機中") {
+		t.Fatalf("queued state is not reported: labels=%v comments=%v", issues.labels, issues.comments)
+	}
+
+	if err := r.OnStart(ctx, task); err != nil {
+		t.Fatalf("OnStart failed: %v", err)
+	}
+	if issues.labels["goose-queued"] || !issues.labels["goose-running"] || !strings.Contains(issues.comments[101], "実行中") {
+		t.Fatalf("running state is not reported: labels=%v comments=%v", issues.labels, issues.comments)
+	}
+
+	// Execute がトランスクリプトを残し、実行記録とともに失敗を返す
+	sessionDir := session.Dir(baseDir, msg.SessionId)
+	n, runDir, err := session.NewRunDir(sessionDir)
+	if err != nil {
+		t.Fatalf("NewRunDir failed: %v", err)
+	}
+	run := &session.Run{Number: n, Status: session.RunStatusFailed, ExitCode: 3, Error: "exit status 3"}
+	transcript := "first line\nusing sk-secret-api-key\nlast line ```\n"
+	if err := os.WriteFile(filepath.Join(runDir, session.TranscriptFileName), []byte(transcript), 0600); err != nil {
+		t.Fatalf("Failed to write transcript: %v", err)
+	}
+	result := &TaskResult{
+		ExitCode:     3,
+		Duration:     90 * time.Second,
+		Err:          errors.New("failed to execute command: exit status 3"),
+		ChangedFiles: []string{"main.go"},
+		Run:          run,
+	}
+
+	if err := r.OnFinally(ctx, task, result); err != nil {
+		t.Fatalf("OnFinally failed: %v", err)
+	}
+	if issues.labels["goose-running"] || !issues.labels["goose-failed"] {
+		t.Errorf("failed label is not set: %v", issues.labels)
+	}
+	if issues.created != 1 {
+		t.Errorf("status comment must be edited in place, created %d comments", issues.created)
+	}
+	body := issues.comments[101]
+	for _, want := range []string{StatusCommentMarker, "失敗", "`gpt-4o`", "1m30s", "| 終了コード | 3 |", "| 変更されたファイル | 1 |", "exit status 3", "last line", "````"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("comment does not contain %q:\n%s", want, body)
+		}
+	}
+	for _, leaked := range []string{"sk-secret-api-key", "first line"} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("comment must not contain %q:\n%s", leaked, body)
+		}
+	}
+	if len(r.reports) != 0 {
+		t.Errorf("finished report is not removed: %v", r.reports)
+	}
+}
+
+// TestStatusReporterDroppedTask はキュー内でキャンセルされたタスクが失敗として報告され、報告の状態が残らないことを確認します
+func TestStatusReporterDroppedTask(t *testing.T) {
+	issues, srv := newFakeIssues(t)
+	host, err := githubhost.New(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r := &StatusReporter{
+		Labels:  config.StatusLabels{Queued: "goose-queued", Running: "goose-running", Succeeded: "goose-succeeded", Failed: "goose-failed"},
+		Comment: true,
+	}
+	f := &GooseAgentFactory{}
+	f.SetGitHubHost(host)
+	f.SetHooks(r)
+	msg := &proto.ExecuteTaskRequest{
+		SessionId: "org-repo-7",
+		Github:    &proto.GitHubInfo{ApiToken: "ghs_token", Repo: "org/repo", IssueNumber: 7},
+	}
+
+	if err := f.HandleTaskQueued(msg); err != nil {
+		t.Fatalf("HandleTaskQueued failed: %v", err)
+	}
+	if err := f.HandleTaskDropped(msg, errors.New("task was cancelled")); err != nil {
+		t.Fatalf("HandleTaskDropped failed: %v", err)
+	}
+	if issues.labels["goose-queued"] || !issues.labels["goose-failed"] {
+		t.Errorf("failed label is not set: %v", issues.labels)
+	}
+	if body := issues.comments[101]; !strings.Contains(body, "失敗") || !strings.Contains(body, "task was cancelled") {
+		t.Errorf("status comment is not updated:\n%s", body)
+	}
+	if len(r.reports) != 0 {
+		t.Errorf("dropped report is not removed: %v", r.reports)
+	}
+}
@@ -0,0 +1,139 @@
+package goose
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/githubapp"
+)
+
+// credentialSocketTimeout はソケット経由のトークンの要求 1 回あたりの上限です
+const credentialSocketTimeout = 30 * time.Second
+
+// NewGitHubApp は設定の GitHub App を返します。github_app_id が設定されていなければ nil を返します
+func NewGitHubApp(cfg *config.Config) (*githubapp.App, error) {
+	id := cfg.GetGitHubAppID()
+	if id == 0 {
+		return nil, nil
+	}
+	key, err := cfg.GetGitHubAppPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	// App は既定の接続先 (github_url) に登録されている
+	host, err := DefaultGitHubHost(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return githubapp.New(id, key, host.APIURL.String())
+}
+
+// installationToken は GitHub App のトークンを取得し、ログや出力から取り除く秘密情報に加えます
+func (a *GooseAgent) installationToken(ctx context.Context) (string, error) {
+	token, err := a.Opts.Tokens.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get installation token: %w", err)
+	}
+	a.redactor.Add(token)
+	return token, nil
+}
+
+// sessionToken は goose と拡張に環境変数で渡すトークンを新しく発行し、ログや出力から取り除く秘密情報に加えます
+// 実行中は更新できないため、キャッシュが残っていてもできるだけ長く有効なものを発行します
+func (a *GooseAgent) sessionToken(ctx context.Context) (*githubapp.Token, error) {
+	token, err := a.Opts.Tokens.Refresh(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installation token: %w", err)
+	}
+	a.redactor.Add(token.Value)
+	return token, nil
+}
+
+// credentialServer は実行中のセッションの credential helper に最新のトークンを返す UNIX ソケットです
+// トークンをディスクに書かずに、1 時間で失効するインストールトークンを長いセッションに渡し続けます
+type credentialServer struct {
+	dir string
+	ln  net.Listener
+}
+
+// serveCredentials は接続ごとに token が返すトークンを 1 行書き込むソケットを開きます
+// ソケットのパス長の制限を避けるため、所有者のみがアクセスできる一時ディレクトリに作成します
+func serveCredentials(token func(ctx context.Context) (string, error)) (*credentialServer, error) {
+	dir, err := os.MkdirTemp("", "goose-connect-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credential socket directory: %w", err)
+	}
+	ln, err := net.Listen("unix", filepath.Join(dir, "credential.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to listen on credential socket: %w", err)
+	}
+	s := &credentialServer{dir: dir, ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn, token)
+		}
+	}()
+	return s, nil
+}
+
+func (s *credentialServer) handle(conn net.Conn, token func(ctx context.Context) (string, error)) {
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), credentialSocketTimeout)
+	defer cancel()
+	_ = conn.SetDeadline(time.Now().Add(credentialSocketTimeout))
+	t, err := token(ctx)
+	if err != nil {
+		// helper は空の応答をエラーとして扱う
+		log.Printf("Failed to serve credential: %v", err)
+		return
+	}
+	if _, err := io.WriteString(conn, t+"\n"); err != nil {
+		log.Printf("Failed to serve credential: %v", err)
+	}
+}
+
+// Path はソケットのパスを返します
+func (s *credentialServer) Path() string {
+	return s.ln.Addr().String()
+}
+
+// Close はソケットを閉じ、一時ディレクトリを削除します
+func (s *credentialServer) Close() error {
+	err := s.ln.Close()
+	if rmErr := os.RemoveAll(s.dir); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// readSocketToken は credentialServer からトークンを読み出します
+func readSocketToken(path string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, credentialSocketTimeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to credential socket: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(credentialSocketTimeout))
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential socket: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("goose-connect could not provide a token")
+	}
+	return token, nil
+}
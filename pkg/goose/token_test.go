@@ -0,0 +1,56 @@
+package goose
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/kommon-ai/goose-connect/pkg/gitcredential"
+)
+
+func TestServeCredentials(t *testing.T) {
+	tokens := []string{"ghs_first", "ghs_refreshed"}
+	// 要求は接続ごとのゴルーチンで処理される
+	var mu sync.Mutex
+	calls := 0
+	srv, err := serveCredentials(func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls >= len(tokens) {
+			return "", errors.New("installation not found")
+		}
+		calls++
+		return tokens[calls-1], nil
+	})
+	if err != nil {
+		t.Fatalf("serveCredentials failed: %v", err)
+	}
+	src := CredentialSource{Socket: srv.Path()}
+	req := &gitcredential.Credential{Protocol: "https", Host: "github.com"}
+
+	// 要求のたびに最新のトークンを返す
+	for _, want := range tokens {
+		got, err := LookupCredential(src, "github.com", req)
+		if err != nil {
+			t.Fatalf("LookupCredential failed: %v", err)
+		}
+		if got.Password != want {
+			t.Errorf("password = %q, want %q", got.Password, want)
+		}
+	}
+	if _, err := LookupCredential(src, "github.com", req); err == nil {
+		t.Errorf("expected error when goose-connect cannot provide a token")
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(srv.Path()); !os.IsNotExist(err) {
+		t.Errorf("credential socket was not removed")
+	}
+	if _, err := LookupCredential(src, "github.com", req); err == nil {
+		t.Errorf("expected error after the socket is closed")
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/kommon-ai/goose-connect/pkg/goose"
+)
+
+const (
+	// outputChannelSize はエージェントから出力を受け取るチャネルのバッファサイズです
+	outputChannelSize = 256
+	// maxOutputLines はタスクごとに保持する実行中の出力の行数です
+	// 途中から購読したクライアントには少なくともこの行数までさかのぼって配信します
+	maxOutputLines = 1000
+)
+
+// OutputSinkAdder は実行中の出力を goose.OutputSink に行単位で書き出せるエージェントが実装します
+type OutputSinkAdder interface {
+	AddOutputSink(sink goose.OutputSink)
+}
+
+// taskOutput は 1 つのタスクの実行中の出力を保持し、購読者に配信します
+type taskOutput struct {
+	// sink はエージェントに渡したシンクで、forwarded は sink からの転送を終えると閉じます
+	sink      *goose.ChannelSink
+	forwarded chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+	// total はこれまでに受け取った行数です (lines は少なくとも末尾の maxOutputLines 行を持ちます)
+	total int
+	// updated は行が追加されるか出力が終わるたびに閉じて作り直します
+	updated chan struct{}
+	done    bool
+}
+
+// newTaskOutput は sink の出力の転送を始めます
+func newTaskOutput(sink *goose.ChannelSink) *taskOutput {
+	o := &taskOutput{sink: sink, forwarded: make(chan struct{}), updated: make(chan struct{})}
+	go func() {
+		defer close(o.forwarded)
+		for line := range sink.C {
+			o.append(line.Text)
+		}
+	}()
+	return o
+}
+
+// drain は sink を閉じ、受け取った行をすべて転送し終えるまで待ちます
+func (o *taskOutput) drain() {
+	_ = o.sink.Close()
+	<-o.forwarded
+}
+
+func (o *taskOutput) append(line string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = append(o.lines, line)
+	// 毎回コピーしないよう、上限の 2 倍に達したときにまとめて捨てる
+	if len(o.lines) >= 2*maxOutputLines {
+		o.lines = append([]string(nil), o.lines[len(o.lines)-maxOutputLines:]...)
+	}
+	o.total++
+	close(o.updated)
+	o.updated = make(chan struct{})
+}
+
+func (o *taskOutput) finish() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done {
+		return
+	}
+	o.done = true
+	close(o.updated)
+}
+
+// read は next 行目以降の行と、次に読む行の番号を返します
+// 新しい行がない場合は、次の更新で閉じられるチャネルと、出力が終わったかどうかも返します
+// 読む前に保持する範囲から外れた行は飛ばします
+func (o *taskOutput) read(next int) (lines []string, following int, updated <-chan struct{}, done bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	first := o.total - len(o.lines)
+	if next < first {
+		next = first
+	}
+	lines = append([]string(nil), o.lines[next-first:]...)
+	return lines, o.total, o.updated, o.done
+}
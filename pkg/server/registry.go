@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskState はタスクの状態です
+type TaskState string
+
+const (
+	TaskStateQueued    TaskState = "queued"
+	TaskStateRunning   TaskState = "running"
+	TaskStateSucceeded TaskState = "succeeded"
+	TaskStateFailed    TaskState = "failed"
+	TaskStateCancelled TaskState = "cancelled"
+)
+
+// IsFinished はタスクが終了状態かどうかを返します
+func (s TaskState) IsFinished() bool {
+	return s == TaskStateSucceeded || s == TaskStateFailed || s == TaskStateCancelled
+}
+
+// TaskRecord はタスクレジストリに保存される 1 件分の情報です
+type TaskRecord struct {
+	ID            string    `json:"id"`
+	SessionID     string    `json:"session_id"`
+	Repo          string    `json:"repo"`
+	State         TaskState `json:"state"`
+	QueuePosition int       `json:"queue_position,omitempty"`
+	SubmittedAt   time.Time `json:"submitted_at"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	Output        string    `json:"output,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Registry はタスクの状態を保持します
+// path が指定されている場合は変更のたびにファイルへ書き出し、再起動後も結果を参照できるようにします
+type Registry struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	tasks     map[string]*TaskRecord
+}
+
+// NewRegistry は新しい Registry を作成します
+// path のファイルが存在する場合は読み込み、終了していなかったタスクは失敗として扱います
+func NewRegistry(path string, retention time.Duration) (*Registry, error) {
+	r := &Registry{
+		path:      path,
+		retention: retention,
+		tasks:     make(map[string]*TaskRecord),
+	}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read task registry: %w", err)
+	}
+	var records []*TaskRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse task registry: %w", err)
+	}
+	for _, rec := range records {
+		if !rec.State.IsFinished() {
+			rec.State = TaskStateFailed
+			rec.Error = "server restarted before the task finished"
+			rec.FinishedAt = time.Now()
+		}
+		r.tasks[rec.ID] = rec
+	}
+	return r, nil
+}
+
+// Add はタスクを登録します
+func (r *Registry) Add(rec *TaskRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+	copied := *rec
+	r.tasks[rec.ID] = &copied
+	r.persistLocked()
+}
+
+// Update はタスクの情報を更新します
+func (r *Registry) Update(id string, fn func(rec *TaskRecord)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.tasks[id]
+	if !ok {
+		return
+	}
+	fn(rec)
+	r.persistLocked()
+}
+
+// Remove はタスクを削除します
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, id)
+	r.persistLocked()
+}
+
+// Get はタスクの情報のコピーを返します
+func (r *Registry) Get(id string) (TaskRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.tasks[id]
+	if !ok {
+		return TaskRecord{}, false
+	}
+	return *rec, true
+}
+
+// List はタスクを投入順に返します
+func (r *Registry) List() []TaskRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]TaskRecord, 0, len(r.tasks))
+	for _, rec := range r.tasks {
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].SubmittedAt.Before(records[j].SubmittedAt)
+	})
+	return records
+}
+
+// pruneLocked は保持期間を過ぎた終了済みのタスクを削除します
+func (r *Registry) pruneLocked(now time.Time) {
+	if r.retention <= 0 {
+		return
+	}
+	for id, rec := range r.tasks {
+		if rec.State.IsFinished() && now.Sub(rec.FinishedAt) > r.retention {
+			delete(r.tasks, id)
+		}
+	}
+}
+
+func (r *Registry) persistLocked() {
+	if r.path == "" {
+		return
+	}
+	records := make([]*TaskRecord, 0, len(r.tasks))
+	for _, rec := range r.tasks {
+		records = append(records, rec)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal task registry: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		log.Printf("Failed to create task registry directory: %v", err)
+		return
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Failed to write task registry: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		log.Printf("Failed to write task registry: %v", err)
+	}
+}
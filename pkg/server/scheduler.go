@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrQueueFull はキューが上限に達してタスクを受け付けられない場合のエラーです
+	ErrQueueFull = errors.New("task queue is full")
+	// ErrShuttingDown はシャットダウン中にタスクが投入された場合のエラーです
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+// Limits はスケジューラの同時実行数とキューの上限です
+// 0 以下の値は無制限を表します
+type Limits struct {
+	MaxConcurrent int
+	MaxQueued     int
+	MaxPerRepo    int
+	MaxPerOrg     int
+}
+
+// Task はスケジューラで実行される 1 件のタスクです
+type Task struct {
+	ID   string
+	Repo string // org/repo
+	Run  func(ctx context.Context)
+	// Drop は開始前にキャンセルやシャットダウンでキューから取り除かれた場合に cause を原因として呼ばれます
+	Drop func(cause error)
+
+	cancel context.CancelCauseFunc
+}
+
+func (t *Task) drop(cause error) {
+	if t.Drop != nil {
+		t.Drop(cause)
+	}
+}
+
+func (t *Task) org() string {
+	org, _, _ := strings.Cut(t.Repo, "/")
+	return org
+}
+
+// Stats はスケジューラの現在の状態です
+type Stats struct {
+	Running int
+	Queued  int
+}
+
+// Scheduler はタスクを FIFO キューに積み、同時実行数の上限内で順に実行します
+// リポジトリ単位・組織単位の上限に達しているタスクは後続のタスクに追い越されます
+type Scheduler struct {
+	mu           sync.Mutex
+	ctx          context.Context
+	cancel       context.CancelCauseFunc
+	closed       bool
+	limits       Limits
+	queue        []*Task
+	running      map[string]*Task
+	runningRepos map[string]int
+	runningOrgs  map[string]int
+	wg           sync.WaitGroup
+}
+
+// NewScheduler は新しい Scheduler を作成します
+func NewScheduler(limits Limits) *Scheduler {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Scheduler{
+		ctx:          ctx,
+		cancel:       cancel,
+		limits:       limits,
+		running:      make(map[string]*Task),
+		runningRepos: make(map[string]int),
+		runningOrgs:  make(map[string]int),
+	}
+}
+
+// NewTaskID はタスク ID を生成します
+func NewTaskID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate task ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// Submit はタスクをキューに追加します
+// 戻り値はキュー内の位置 (1 始まり) で、すぐに実行を開始した場合は 0 です
+func (s *Scheduler) Submit(task *Task) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return -1, ErrShuttingDown
+	}
+	if s.limits.MaxQueued > 0 && len(s.queue) >= s.limits.MaxQueued {
+		return -1, fmt.Errorf("%w: %d tasks waiting (max %d)", ErrQueueFull, len(s.queue), s.limits.MaxQueued)
+	}
+	s.queue = append(s.queue, task)
+	s.dispatchLocked()
+	return s.positionLocked(task.ID), nil
+}
+
+// Position はキュー内の位置 (1 始まり) を返します
+// 実行中の場合は 0、キューにも実行中にも存在しない場合は -1 を返します
+func (s *Scheduler) Position(taskID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.positionLocked(taskID)
+}
+
+// Stats は実行中とキュー内のタスク数を返します
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Running: len(s.running), Queued: len(s.queue)}
+}
+
+// Wait は実行中のタスクがすべて終了するまで待ちます
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Close は新しいタスクの受け付けを停止し、まだ開始していないタスクをキューから取り除いて返します
+// 取り除いたタスクの Drop は cause を原因として呼び出します
+func (s *Scheduler) Close(cause error) []*Task {
+	s.mu.Lock()
+	s.closed = true
+	dropped := s.queue
+	s.queue = nil
+	s.mu.Unlock()
+	for _, task := range dropped {
+		task.drop(cause)
+	}
+	return dropped
+}
+
+// Shutdown は Close した上で実行中のタスクの終了を ctx の期限まで待ちます
+// 期限を過ぎた場合は cause を原因としてタスクのコンテキストをキャンセルし、
+// タスクが後処理を終えて戻るまで待ちます
+func (s *Scheduler) Shutdown(ctx context.Context, cause error) []*Task {
+	dropped := s.Close(cause)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.cancel(cause)
+		<-done
+	}
+	return dropped
+}
+
+// Cancel はタスクをキャンセルします
+// キュー内のタスクは取り除いて Drop を呼び出し、実行中のタスクは cause を原因としてコンテキストをキャンセルします
+// 戻り値の running はタスクが実行中だったかどうか、ok はタスクが見つかったかどうかです
+func (s *Scheduler) Cancel(taskID string, cause error) (running bool, ok bool) {
+	s.mu.Lock()
+	if task, found := s.running[taskID]; found {
+		task.cancel(cause)
+		s.mu.Unlock()
+		return true, true
+	}
+	for i, task := range s.queue {
+		if task.ID == taskID {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.mu.Unlock()
+			task.drop(cause)
+			return false, true
+		}
+	}
+	s.mu.Unlock()
+	return false, false
+}
+
+func (s *Scheduler) positionLocked(taskID string) int {
+	if _, ok := s.running[taskID]; ok {
+		return 0
+	}
+	for i, t := range s.queue {
+		if t.ID == taskID {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (s *Scheduler) canStartLocked(task *Task) bool {
+	if s.limits.MaxConcurrent > 0 && len(s.running) >= s.limits.MaxConcurrent {
+		return false
+	}
+	if s.limits.MaxPerRepo > 0 && s.runningRepos[task.Repo] >= s.limits.MaxPerRepo {
+		return false
+	}
+	if s.limits.MaxPerOrg > 0 && s.runningOrgs[task.org()] >= s.limits.MaxPerOrg {
+		return false
+	}
+	return true
+}
+
+// dispatchLocked はキューの先頭から開始可能なタスクを実行します
+func (s *Scheduler) dispatchLocked() {
+	remaining := s.queue[:0]
+	for _, task := range s.queue {
+		if !s.canStartLocked(task) {
+			remaining = append(remaining, task)
+			continue
+		}
+		s.startLocked(task)
+	}
+	// 取り除いたタスクへの参照を残さない
+	for i := len(remaining); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = remaining
+}
+
+func (s *Scheduler) startLocked(task *Task) {
+	s.running[task.ID] = task
+	s.runningRepos[task.Repo]++
+	s.runningOrgs[task.org()]++
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	task.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.finish(task)
+		defer cancel(nil)
+		task.Run(ctx)
+	}()
+}
+
+func (s *Scheduler) finish(task *Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, task.ID)
+	s.runningRepos[task.Repo]--
+	if s.runningRepos[task.Repo] <= 0 {
+		delete(s.runningRepos, task.Repo)
+	}
+	s.runningOrgs[task.org()]--
+	if s.runningOrgs[task.org()] <= 0 {
+		delete(s.runningOrgs, task.org())
+	}
+	s.dispatchLocked()
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingTask は release が閉じられるまで終了しないタスクを作成します
+func blockingTask(id, repo string, started chan<- string, release <-chan struct{}) *Task {
+	return &Task{
+		ID:   id,
+		Repo: repo,
+		Run: func(ctx context.Context) {
+			started <- id
+			<-release
+		},
+	}
+}
+
+func waitStarted(t *testing.T, started <-chan string) string {
+	t.Helper()
+	select {
+	case id := <-started:
+		return id
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for task to start")
+		return ""
+	}
+}
+
+func TestSchedulerQueuesBeyondMaxConcurrent(t *testing.T) {
+	s := NewScheduler(Limits{MaxConcurrent: 1, MaxQueued: 1})
+	started := make(chan string, 3)
+	release := make(chan struct{})
+
+	pos, err := s.Submit(blockingTask("a", "org/repo1", started, release))
+	if err != nil || pos != 0 {
+		t.Fatalf("Submit(a) = %d, %v, expected 0, nil", pos, err)
+	}
+	waitStarted(t, started)
+
+	pos, err = s.Submit(blockingTask("b", "org/repo2", started, release))
+	if err != nil || pos != 1 {
+		t.Fatalf("Submit(b) = %d, %v, expected 1, nil", pos, err)
+	}
+	if s.Position("b") != 1 {
+		t.Errorf("Position(b) = %d, expected 1", s.Position("b"))
+	}
+
+	if _, err := s.Submit(blockingTask("c", "org/repo3", started, release)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit(c) error = %v, expected ErrQueueFull", err)
+	}
+
+	close(release)
+	if id := waitStarted(t, started); id != "b" {
+		t.Errorf("expected b to start after a, got %s", id)
+	}
+	s.Wait()
+	if stats := s.Stats(); stats.Running != 0 || stats.Queued != 0 {
+		t.Errorf("unexpected stats after completion: %+v", stats)
+	}
+	if s.Position("a") != -1 {
+		t.Errorf("Position(a) = %d, expected -1", s.Position("a"))
+	}
+}
+
+func TestSchedulerPerRepoAndOrgLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits Limits
+		repos  []string
+		// 最初の 2 件を投入した直後に実行中となるタスク数
+		expectedRunning int
+	}{
+		{
+			name:            "同じリポジトリは 1 件ずつ",
+			limits:          Limits{MaxConcurrent: 4, MaxPerRepo: 1},
+			repos:           []string{"org/repo", "org/repo", "org/other"},
+			expectedRunning: 2,
+		},
+		{
+			name:            "同じ組織は 1 件ずつ",
+			limits:          Limits{MaxConcurrent: 4, MaxPerOrg: 1},
+			repos:           []string{"org/repo", "org/other", "org2/repo"},
+			expectedRunning: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewScheduler(tc.limits)
+			started := make(chan string, len(tc.repos))
+			release := make(chan struct{})
+			for i, repo := range tc.repos {
+				if _, err := s.Submit(blockingTask(string(rune('a'+i)), repo, started, release)); err != nil {
+					t.Fatalf("Submit failed: %v", err)
+				}
+			}
+			for i := 0; i < tc.expectedRunning; i++ {
+				waitStarted(t, started)
+			}
+			stats := s.Stats()
+			if stats.Running != tc.expectedRunning || stats.Queued != len(tc.repos)-tc.expectedRunning {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+			// 2 件目は制限により待たされ、3 件目が追い越して実行される
+			if s.Position("b") != 1 || s.Position("c") != 0 {
+				t.Errorf("Position(b) = %d, Position(c) = %d", s.Position("b"), s.Position("c"))
+			}
+			close(release)
+			s.Wait()
+		})
+	}
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	s := NewScheduler(Limits{MaxConcurrent: 1})
+	errInterrupted := errors.New("interrupted")
+	started := make(chan string, 1)
+	causes := make(chan error, 1)
+
+	if _, err := s.Submit(&Task{
+		ID:   "a",
+		Repo: "org/repo",
+		Run: func(ctx context.Context) {
+			started <- "a"
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+		},
+	}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	waitStarted(t, started)
+	if _, err := s.Submit(&Task{ID: "b", Repo: "org/repo", Run: func(ctx context.Context) {
+		t.Errorf("queued task must not run after shutdown")
+	}}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dropped := s.Shutdown(ctx, errInterrupted)
+	if len(dropped) != 1 || dropped[0].ID != "b" {
+		t.Errorf("unexpected dropped tasks: %v", dropped)
+	}
+	if cause := <-causes; !errors.Is(cause, errInterrupted) {
+		t.Errorf("task context cause = %v, expected %v", cause, errInterrupted)
+	}
+	if _, err := s.Submit(&Task{ID: "c", Run: func(ctx context.Context) {}}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Submit after shutdown error = %v, expected ErrShuttingDown", err)
+	}
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/agent-connect/gen/proto/protoconnect"
+	"github.com/kommon-ai/agent-connect/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/goose"
+	"github.com/kommon-ai/goose-connect/pkg/session"
+)
+
+// TaskQueueHandler はタスクが実行を待つ場合の処理を持つファクトリが実装します
+type TaskQueueHandler interface {
+	HandleTaskQueued(msg *proto.ExecuteTaskRequest) error
+}
+
+// TaskDropHandler はキュー内のタスクが開始前に取り除かれた場合の処理を持つファクトリが実装します
+// キャンセルやシャットダウンで実行されなかったタスクの後処理 (状態の報告など) に使います
+type TaskDropHandler interface {
+	HandleTaskDropped(msg *proto.ExecuteTaskRequest, cause error) error
+}
+
+// ErrTaskCancelled はキャンセル要求によりタスクが中断された場合の原因です
+var ErrTaskCancelled = errors.New("task was cancelled")
+
+// RemoteAgentServer は RemoteAgentService の実装です
+// 受け付けたタスクは Scheduler を通して同時実行数の上限内で非同期に実行され、
+// 状態と結果は Registry から参照できます
+type RemoteAgentServer struct {
+	factory   agent.AgentFactory
+	scheduler *Scheduler
+	registry  *Registry
+
+	mu sync.Mutex
+	// outputs は OutputSinkAdder を実装するエージェントの、終了していないタスクの出力です
+	outputs map[string]*taskOutput
+}
+
+// NewRemoteAgentServer は新しい RemoteAgentServer を作成します
+func NewRemoteAgentServer(factory agent.AgentFactory, limits Limits, registry *Registry) *RemoteAgentServer {
+	return &RemoteAgentServer{
+		factory:   factory,
+		scheduler: NewScheduler(limits),
+		registry:  registry,
+		outputs:   make(map[string]*taskOutput),
+	}
+}
+
+// ExecuteTask はタスクをキューに追加し、タスク ID とキュー内の位置をすぐに返します
+// 実行の状態と結果は /tasks/{id} エンドポイントで参照します
+func (s *RemoteAgentServer) ExecuteTask(
+	ctx context.Context,
+	req *connect.Request[proto.ExecuteTaskRequest],
+) (*connect.Response[proto.ExecuteTaskResponse], error) {
+	rec, err := s.Submit(req.Msg)
+	if err != nil {
+		if errors.Is(err, ErrQueueFull) {
+			return nil, connect.NewError(connect.CodeResourceExhausted, err)
+		}
+		if errors.Is(err, ErrShuttingDown) {
+			return nil, connect.NewError(connect.CodeUnavailable, err)
+		}
+		if errors.Is(err, errInvalidRequest) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+		return nil, err
+	}
+
+	stdout := fmt.Sprintf("Task %s started", rec.ID)
+	if rec.QueuePosition > 0 {
+		stdout = fmt.Sprintf("Task %s enqueued successfully (queue position: %d)", rec.ID, rec.QueuePosition)
+	}
+	resp := connect.NewResponse(&proto.ExecuteTaskResponse{
+		SessionId: rec.SessionID,
+		Stdout:    stdout,
+		Stderr:    "",
+		Success:   true,
+	})
+	resp.Header().Set(TaskIDHeader, rec.ID)
+	return resp, nil
+}
+
+// errInvalidRequest は ExecuteTaskRequest に必須の情報が欠けている場合のエラーです
+var errInvalidRequest = errors.New("provider and github are required")
+
+// Submit はタスクを登録してキューに追加し、登録した情報を返します
+func (s *RemoteAgentServer) Submit(msg *proto.ExecuteTaskRequest) (TaskRecord, error) {
+	taskAgent, err := s.factory.NewAgentFactory()(msg)
+	if err != nil {
+		return TaskRecord{}, err
+	}
+	if taskAgent == nil {
+		return TaskRecord{}, errInvalidRequest
+	}
+
+	task := &Task{
+		ID:   NewTaskID(),
+		Repo: msg.GetGithub().GetRepo(),
+	}
+	var output *taskOutput
+	if adder, ok := taskAgent.(OutputSinkAdder); ok {
+		sink := goose.NewChannelSink(outputChannelSize)
+		adder.AddOutputSink(sink)
+		output = newTaskOutput(sink)
+		s.mu.Lock()
+		s.outputs[task.ID] = output
+		s.mu.Unlock()
+	}
+	task.Run = func(ctx context.Context) {
+		s.registry.Update(task.ID, func(rec *TaskRecord) {
+			rec.State = TaskStateRunning
+			rec.StartedAt = time.Now()
+		})
+		// 実行前後の処理はエージェントが Execute の中でフックとして呼び出す
+		out, err := taskAgent.Execute(ctx, msg.Instruction)
+		if err != nil {
+			// キャンセルの理由 (シャットダウンなど) を記録に残す
+			if cause := context.Cause(ctx); cause != nil && !errors.Is(err, cause) {
+				err = fmt.Errorf("%w: %w", cause, err)
+			}
+			log.Printf("Error executing task: %v", err)
+		}
+		// 出力の配信を終える前に結果を記録し、配信が終わったタスクの結果をすぐ取得できるようにする
+		if output != nil {
+			output.drain()
+		}
+		defer s.finishOutput(task.ID)
+		s.registry.Update(task.ID, func(rec *TaskRecord) {
+			rec.FinishedAt = time.Now()
+			rec.Output = out
+			switch {
+			case err == nil:
+				rec.State = TaskStateSucceeded
+			case errors.Is(err, ErrTaskCancelled):
+				rec.State = TaskStateCancelled
+				rec.Error = err.Error()
+			default:
+				rec.State = TaskStateFailed
+				rec.Error = err.Error()
+			}
+		})
+	}
+
+	task.Drop = func(cause error) {
+		s.registry.Update(task.ID, func(rec *TaskRecord) {
+			rec.State = TaskStateCancelled
+			rec.FinishedAt = time.Now()
+			rec.Error = cause.Error()
+		})
+		s.finishOutput(task.ID)
+		if h, ok := s.factory.(TaskDropHandler); ok {
+			if err := h.HandleTaskDropped(msg, cause); err != nil {
+				log.Printf("Error handling dropped task: %v", err)
+			}
+		}
+	}
+
+	s.registry.Add(&TaskRecord{
+		ID:          task.ID,
+		SessionID:   msg.SessionId,
+		Repo:        task.Repo,
+		State:       TaskStateQueued,
+		SubmittedAt: time.Now(),
+	})
+	position, err := s.scheduler.Submit(task)
+	if err != nil {
+		s.registry.Remove(task.ID)
+		s.finishOutput(task.ID)
+		return TaskRecord{}, err
+	}
+
+	if h, ok := s.factory.(TaskQueueHandler); ok && position > 0 {
+		if err := h.HandleTaskQueued(msg); err != nil {
+			log.Printf("Error handling queued task: %v", err)
+		}
+	}
+
+	stats := s.scheduler.Stats()
+	log.Printf("Task %s for session %s accepted (position: %d, running: %d, queued: %d)",
+		task.ID, msg.SessionId, position, stats.Running, stats.Queued)
+
+	rec, _ := s.registry.Get(task.ID)
+	rec.QueuePosition = position
+	return rec, nil
+}
+
+// output はタスクの実行中の出力を返します。終了したタスクや出力を配信しないエージェントの場合は nil です
+func (s *RemoteAgentServer) output(id string) *taskOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outputs[id]
+}
+
+// finishOutput はタスクの出力の配信を終え、購読者に出力の終わりを知らせます
+func (s *RemoteAgentServer) finishOutput(id string) {
+	s.mu.Lock()
+	output := s.outputs[id]
+	delete(s.outputs, id)
+	s.mu.Unlock()
+	if output != nil {
+		output.drain()
+		output.finish()
+	}
+}
+
+// Task はタスクの情報を返します。キュー内のタスクは現在の位置を含みます
+func (s *RemoteAgentServer) Task(id string) (TaskRecord, bool) {
+	rec, ok := s.registry.Get(id)
+	if !ok {
+		return TaskRecord{}, false
+	}
+	if rec.State == TaskStateQueued {
+		rec.QueuePosition = s.scheduler.Position(id)
+	}
+	return rec, true
+}
+
+// Cancel はタスクをキャンセルします
+// キュー内のタスクはその場でキャンセル済みになって TaskDropHandler が呼ばれ、
+// 実行中のタスクは Execute が戻った時点でキャンセル済みになります
+func (s *RemoteAgentServer) Cancel(id string) (TaskRecord, error) {
+	rec, ok := s.registry.Get(id)
+	if !ok {
+		return TaskRecord{}, ErrTaskNotFound
+	}
+	if rec.State.IsFinished() {
+		return rec, fmt.Errorf("%w: task is already %s", ErrTaskFinished, rec.State)
+	}
+	running, found := s.scheduler.Cancel(id, ErrTaskCancelled)
+	if !found {
+		return rec, fmt.Errorf("%w: task is already %s", ErrTaskFinished, rec.State)
+	}
+	log.Printf("Task %s cancelled (running: %t)", id, running)
+	rec, _ = s.registry.Get(id)
+	return rec, nil
+}
+
+// CancelSession は指定したセッションの未終了タスクをすべてキャンセルします
+// 実行中のタスクはコンテキストのキャンセルにより goose のプロセスグループごと停止されます
+func (s *RemoteAgentServer) CancelSession(sessionID string) ([]TaskRecord, error) {
+	id := session.NormalizeID(sessionID)
+	var cancelled []TaskRecord
+	for _, rec := range s.registry.List() {
+		if session.NormalizeID(rec.SessionID) != id || rec.State.IsFinished() {
+			continue
+		}
+		rec, err := s.Cancel(rec.ID)
+		if err != nil {
+			// キャンセル処理の間に終了したタスクは対象外とする
+			if errors.Is(err, ErrTaskFinished) {
+				continue
+			}
+			return cancelled, err
+		}
+		cancelled = append(cancelled, rec)
+	}
+	if len(cancelled) == 0 {
+		return nil, fmt.Errorf("%w: no active task for session %s", ErrTaskNotFound, sessionID)
+	}
+	return cancelled, nil
+}
+
+// Shutdown は新しいタスクの受け付けを停止し、実行中のタスクの終了を ctx の期限まで待ちます
+// キュー内のタスクは cause を原因としてキャンセル済みになり、TaskDropHandler が呼ばれます
+// 期限を過ぎたタスクは cause を原因としてキャンセルされ、フックを実行してから終了します
+func (s *RemoteAgentServer) Shutdown(ctx context.Context, cause error) {
+	stats := s.scheduler.Stats()
+	log.Printf("Shutting down remote agent server (running: %d, queued: %d)", stats.Running, stats.Queued)
+	dropped := s.scheduler.Shutdown(ctx, cause)
+	for _, task := range dropped {
+		log.Printf("Dropped queued task %s for %s", task.ID, task.Repo)
+	}
+}
+
+// Ping はサーバーの状態を確認するメソッドです
+func (s *RemoteAgentServer) Ping(
+	ctx context.Context,
+	req *connect.Request[proto.PingRequest],
+) (*connect.Response[proto.PingResponse], error) {
+	log.Println("Ping received")
+
+	res := &proto.PingResponse{
+		Status: "OK",
+	}
+
+	return connect.NewResponse(res), nil
+}
+
+// Handler は RemoteAgentService の HTTP ハンドラを返します
+func (s *RemoteAgentServer) Handler() (string, http.Handler) {
+	return protoconnect.NewRemoteAgentServiceHandler(s)
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/agent-go/pkg/agent"
+	"github.com/kommon-ai/goose-connect/pkg/goose"
+)
+
+// fakeAgent は開始時に lines を出力し、release が閉じられるかコンテキストがキャンセルされるまで実行を続けるエージェントです
+type fakeAgent struct {
+	agent.NoopAgent
+	release chan struct{}
+	lines   []string
+	sinks   []goose.OutputSink
+}
+
+func (a *fakeAgent) AddOutputSink(sink goose.OutputSink) {
+	a.sinks = append(a.sinks, sink)
+}
+
+func (a *fakeAgent) Execute(ctx context.Context, input string) (string, error) {
+	for _, line := range a.lines {
+		for _, sink := range a.sinks {
+			_ = sink.WriteLine(goose.OutputLine{Text: line})
+		}
+	}
+	select {
+	case <-a.release:
+		return "done: " + input, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+type fakeFactory struct {
+	release chan struct{}
+	// lines はエージェントが開始時に出力する行です
+	lines []string
+
+	mu      sync.Mutex
+	dropped map[string]error
+}
+
+// HandleTaskDropped は開始前に取り除かれたタスクのセッションと原因を記録します
+func (f *fakeFactory) HandleTaskDropped(msg *proto.ExecuteTaskRequest, cause error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped == nil {
+		f.dropped = make(map[string]error)
+	}
+	f.dropped[msg.SessionId] = cause
+	return nil
+}
+
+func (f *fakeFactory) SetBeforeTaskExecutionFunc(func(msg *proto.ExecuteTaskRequest) error) error {
+	return nil
+}
+
+func (f *fakeFactory) SetAfterTaskExecutionFunc(func(msg *proto.ExecuteTaskRequest) error) error {
+	return nil
+}
+
+func (f *fakeFactory) GetBeforeTaskExecutionFunc() func(msg *proto.ExecuteTaskRequest) error {
+	return func(msg *proto.ExecuteTaskRequest) error { return nil }
+}
+
+func (f *fakeFactory) GetAfterTaskExecutionFunc() func(msg *proto.ExecuteTaskRequest) error {
+	return func(msg *proto.ExecuteTaskRequest) error { return nil }
+}
+
+func (f *fakeFactory) NewAgentFactory() func(msg *proto.ExecuteTaskRequest) (agent.Agent, error) {
+	return func(msg *proto.ExecuteTaskRequest) (agent.Agent, error) {
+		return &fakeAgent{release: f.release, lines: f.lines}, nil
+	}
+}
+
+func newTestServer(t *testing.T, limits Limits, registryPath string) (*RemoteAgentServer, *httptest.Server, *fakeFactory) {
+	t.Helper()
+	registry, err := NewRegistry(registryPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	factory := &fakeFactory{release: make(chan struct{})}
+	s := NewRemoteAgentServer(factory, limits, registry)
+	mux := http.NewServeMux()
+	s.RegisterTaskHandlers(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return s, ts, factory
+}
+
+func submitTask(t *testing.T, ts *httptest.Server, sessionID string) TaskRecord {
+	t.Helper()
+	body := `{"sessionId":"` + sessionID + `","instruction":"hello","provider":{"providerName":"openai"},"github":{"repo":"org/repo"}}`
+	resp, err := http.Post(ts.URL+"/tasks", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /tasks failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /tasks status = %d, expected %d", resp.StatusCode, http.StatusAccepted)
+	}
+	var rec TaskRecord
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Header.Get(TaskIDHeader) != rec.ID {
+		t.Errorf("%s header = %s, expected %s", TaskIDHeader, resp.Header.Get(TaskIDHeader), rec.ID)
+	}
+	return rec
+}
+
+func getTask(t *testing.T, ts *httptest.Server, path string) (int, TaskRecord) {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	var rec TaskRecord
+	_ = json.NewDecoder(resp.Body).Decode(&rec)
+	return resp.StatusCode, rec
+}
+
+func waitState(t *testing.T, s *RemoteAgentServer, id string, state TaskState) TaskRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if rec, _ := s.Task(id); rec.State == state {
+			return rec
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec, _ := s.Task(id)
+	t.Fatalf("task %s state = %s, expected %s", id, rec.State, state)
+	return rec
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	s, ts, factory := newTestServer(t, Limits{MaxConcurrent: 1}, "")
+
+	first := submitTask(t, ts, "session-1")
+	second := submitTask(t, ts, "session-2")
+	if second.QueuePosition != 1 {
+		t.Errorf("second task queue position = %d, expected 1", second.QueuePosition)
+	}
+	waitState(t, s, first.ID, TaskStateRunning)
+
+	if status, rec := getTask(t, ts, "/tasks/"+second.ID); status != http.StatusOK || rec.State != TaskStateQueued || rec.QueuePosition != 1 {
+		t.Errorf("GET /tasks/{id} = %d, %+v", status, rec)
+	}
+	if status, _ := getTask(t, ts, "/tasks/"+first.ID+"/result"); status != http.StatusConflict {
+		t.Errorf("GET /tasks/{id}/result for running task status = %d, expected %d", status, http.StatusConflict)
+	}
+
+	// キュー内のタスクはその場でキャンセルされる
+	resp, err := http.Post(ts.URL+"/tasks/"+second.ID+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST cancel failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("cancel status = %d, expected %d", resp.StatusCode, http.StatusAccepted)
+	}
+	waitState(t, s, second.ID, TaskStateCancelled)
+
+	close(factory.release)
+	waitState(t, s, first.ID, TaskStateSucceeded)
+	status, rec := getTask(t, ts, "/tasks/"+first.ID+"/result")
+	if status != http.StatusOK || rec.Output != "done: hello" {
+		t.Errorf("GET /tasks/{id}/result = %d, %+v", status, rec)
+	}
+
+	if status, _ := getTask(t, ts, "/tasks/unknown"); status != http.StatusNotFound {
+		t.Errorf("GET unknown task status = %d, expected %d", status, http.StatusNotFound)
+	}
+}
+
+func TestCancelRunningTask(t *testing.T) {
+	s, ts, _ := newTestServer(t, Limits{MaxConcurrent: 1}, "")
+
+	rec := submitTask(t, ts, "session-1")
+	waitState(t, s, rec.ID, TaskStateRunning)
+	if _, err := s.Cancel(rec.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	rec = waitState(t, s, rec.ID, TaskStateCancelled)
+	if !strings.Contains(rec.Error, ErrTaskCancelled.Error()) {
+		t.Errorf("cancelled task error = %q", rec.Error)
+	}
+	if _, err := s.Cancel(rec.ID); err == nil {
+		t.Errorf("expected error when cancelling a finished task")
+	}
+}
+
+func TestRegistryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	s, ts, factory := newTestServer(t, Limits{MaxConcurrent: 1}, path)
+
+	done := submitTask(t, ts, "session-1")
+	close(factory.release)
+	waitState(t, s, done.ID, TaskStateSucceeded)
+
+	// 実行中のまま再起動したタスクは失敗扱いになる
+	s.registry.Add(&TaskRecord{ID: "running", State: TaskStateRunning, SubmittedAt: time.Now()})
+
+	registry, err := NewRegistry(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+	if rec, ok := registry.Get(done.ID); !ok || rec.State != TaskStateSucceeded || rec.Output != "done: hello" {
+		t.Errorf("persisted task = %+v, %t", rec, ok)
+	}
+	if rec, ok := registry.Get("running"); !ok || rec.State != TaskStateFailed {
+		t.Errorf("interrupted task = %+v, %t", rec, ok)
+	}
+}
+
+func TestCancelSession(t *testing.T) {
+	s, ts, _ := newTestServer(t, Limits{MaxConcurrent: 1}, "")
+
+	running := submitTask(t, ts, "org/repo/issues/1")
+	queued := submitTask(t, ts, "org/repo/issues/1")
+	other := submitTask(t, ts, "org/repo/issues/2")
+	waitState(t, s, running.ID, TaskStateRunning)
+
+	resp, err := http.Post(ts.URL+"/sessions/"+url.PathEscape("org/repo/issues/1")+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST session cancel failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("session cancel status = %d, expected %d", resp.StatusCode, http.StatusAccepted)
+	}
+	var records []TaskRecord
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("cancelled %d tasks, expected 2", len(records))
+	}
+	waitState(t, s, running.ID, TaskStateCancelled)
+	waitState(t, s, queued.ID, TaskStateCancelled)
+	// 別セッションのタスクはキャンセルされずに実行される
+	waitState(t, s, other.ID, TaskStateRunning)
+
+	// セッション ID は正規化後の形式でも指定できる
+	if _, err := s.CancelSession("org-repo-issues-2"); err != nil {
+		t.Errorf("CancelSession with normalized id failed: %v", err)
+	}
+	waitState(t, s, other.ID, TaskStateCancelled)
+
+	if _, err := s.CancelSession("org/repo/issues/1"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("CancelSession without active tasks error = %v, expected ErrTaskNotFound", err)
+	}
+}
+
+// TestDroppedTasks はキュー内のタスクがキャンセルやシャットダウンで取り除かれたときに
+// キャンセル済みになり、ファクトリに原因が渡されることを確認します
+func TestDroppedTasks(t *testing.T) {
+	s, ts, factory := newTestServer(t, Limits{MaxConcurrent: 1}, "")
+
+	running := submitTask(t, ts, "session-1")
+	cancelled := submitTask(t, ts, "session-2")
+	queued := submitTask(t, ts, "session-3")
+	waitState(t, s, running.ID, TaskStateRunning)
+
+	if _, err := s.Cancel(cancelled.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	close(factory.release)
+	errShutdown := errors.New("server is shutting down")
+	s.Shutdown(context.Background(), errShutdown)
+
+	testCases := []struct {
+		name      string
+		id        string
+		sessionID string
+		cause     error
+	}{
+		{name: "キャンセル", id: cancelled.ID, sessionID: "session-2", cause: ErrTaskCancelled},
+		{name: "シャットダウン", id: queued.ID, sessionID: "session-3", cause: errShutdown},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, _ := s.Task(tc.id)
+			if rec.State != TaskStateCancelled || rec.Error != tc.cause.Error() || rec.FinishedAt.IsZero() {
+				t.Errorf("dropped task = %+v", rec)
+			}
+			factory.mu.Lock()
+			defer factory.mu.Unlock()
+			if got := factory.dropped[tc.sessionID]; !errors.Is(got, tc.cause) {
+				t.Errorf("HandleTaskDropped cause = %v, want %v", got, tc.cause)
+			}
+		})
+	}
+	if rec, _ := s.Task(running.ID); rec.State != TaskStateSucceeded {
+		t.Errorf("running task must finish before shutdown: %+v", rec)
+	}
+	if _, ok := factory.dropped["session-1"]; ok {
+		t.Errorf("started task must not be dropped")
+	}
+}
+
+// TestStreamTaskOutput は実行中のタスクの出力がタスクの終了まで配信されることを確認します
+func TestStreamTaskOutput(t *testing.T) {
+	s, ts, factory := newTestServer(t, Limits{MaxConcurrent: 1}, "")
+	factory.lines = []string{"first line", "second line"}
+
+	rec := submitTask(t, ts, "session-1")
+	waitState(t, s, rec.ID, TaskStateRunning)
+
+	resp, err := http.Get(ts.URL + "/tasks/" + rec.ID + "/output")
+	if err != nil {
+		t.Fatalf("GET output failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET output = %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	// 実行中に届いた行は終了を待たずに読める
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range factory.lines {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != want+"\n" {
+			t.Fatalf("streamed line = %q, %v, want %q", line, err, want)
+		}
+	}
+
+	// タスクが終わると配信も終わり、その時点で結果を取得できる
+	close(factory.release)
+	if rest, err := io.ReadAll(reader); err != nil || len(rest) != 0 {
+		t.Errorf("unexpected rest of stream: %q, %v", rest, err)
+	}
+	if status, rec := getTask(t, ts, "/tasks/"+rec.ID+"/result"); status != http.StatusOK || rec.State != TaskStateSucceeded {
+		t.Errorf("GET result after stream = %d, %+v", status, rec)
+	}
+
+	// 終了したタスクは結果の出力を返す
+	resp, err = http.Get(ts.URL + "/tasks/" + rec.ID + "/output")
+	if err != nil {
+		t.Fatalf("GET output failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "done: hello" {
+		t.Errorf("output of finished task = %q", body)
+	}
+	if s.output(rec.ID) != nil {
+		t.Errorf("output of finished task is not released")
+	}
+
+	if resp, err := http.Get(ts.URL + "/tasks/unknown/output"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET unknown output = %v, %v", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// TaskIDHeader は ExecuteTask のレスポンスでタスク ID を返すヘッダです
+const TaskIDHeader = "X-Task-Id"
+
+// maxSubmitBodyBytes は POST /tasks で受け付けるリクエストボディの上限です
+const maxSubmitBodyBytes = 1 << 20
+
+var (
+	// ErrTaskNotFound は指定されたタスクが存在しない場合のエラーです
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskFinished は終了済みのタスクを操作しようとした場合のエラーです
+	ErrTaskFinished = errors.New("task has already finished")
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// RegisterTaskHandlers はタスクの投入・状態・結果・キャンセルの HTTP エンドポイントを登録します
+//
+//	POST /tasks              ExecuteTaskRequest (JSON) を投入し、タスクの情報を返す
+//	GET  /tasks              タスクの一覧
+//	GET  /tasks/{id}         タスクの状態
+//	GET  /tasks/{id}/result  終了したタスクの結果 (未終了の場合は 409)
+//	GET  /tasks/{id}/output  実行中の出力をタスクが終わるまで text/plain で配信 (終了後は結果の出力)
+//	POST /tasks/{id}/cancel  タスクのキャンセル
+//	POST /sessions/{id}/cancel  セッションの未終了タスクをすべてキャンセル
+func (s *RemoteAgentServer) RegisterTaskHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /tasks", s.handleSubmitTask)
+	mux.HandleFunc("GET /tasks", s.handleListTasks)
+	mux.HandleFunc("GET /tasks/{id}", s.handleGetTask)
+	mux.HandleFunc("GET /tasks/{id}/result", s.handleGetTaskResult)
+	mux.HandleFunc("GET /tasks/{id}/output", s.handleStreamTaskOutput)
+	mux.HandleFunc("POST /tasks/{id}/cancel", s.handleCancelTask)
+	mux.HandleFunc("POST /sessions/{id}/cancel", s.handleCancelSession)
+}
+
+func (s *RemoteAgentServer) handleSubmitTask(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSubmitBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	msg := &proto.ExecuteTaskRequest{}
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rec, err := s.Submit(msg)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrQueueFull):
+			writeError(w, http.StatusTooManyRequests, err)
+		case errors.Is(err, ErrShuttingDown):
+			writeError(w, http.StatusServiceUnavailable, err)
+		case errors.Is(err, errInvalidRequest):
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	w.Header().Set(TaskIDHeader, rec.ID)
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+func (s *RemoteAgentServer) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	records := s.registry.List()
+	for i := range records {
+		if records[i].State == TaskStateQueued {
+			records[i].QueuePosition = s.scheduler.Position(records[i].ID)
+		}
+		// 一覧では出力を省略する
+		records[i].Output = ""
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *RemoteAgentServer) handleGetTask(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.Task(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrTaskNotFound)
+		return
+	}
+	rec.Output = ""
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func (s *RemoteAgentServer) handleGetTaskResult(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.Task(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrTaskNotFound)
+		return
+	}
+	if !rec.State.IsFinished() {
+		writeJSON(w, http.StatusConflict, rec)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// handleStreamTaskOutput は保持している出力を送った後、新しい行をタスクが終わるかクライアントが切断するまで送ります
+// 出力を配信しないエージェントのタスクと終了したタスクは、結果の出力 (末尾の要約) を返します
+func (s *RemoteAgentServer) handleStreamTaskOutput(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	output := s.output(id)
+	rec, ok := s.Task(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrTaskNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if output == nil {
+		_, _ = io.WriteString(w, rec.Output)
+		return
+	}
+	// 配信はタスクが終わるまで続くため、サーバーの書き込みのタイムアウトを外す
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	next := 0
+	for {
+		lines, following, updated, done := output.read(next)
+		next = following
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if done {
+			return
+		}
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *RemoteAgentServer) handleCancelTask(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.Cancel(r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTaskNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrTaskFinished):
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+func (s *RemoteAgentServer) handleCancelSession(w http.ResponseWriter, r *http.Request) {
+	records, err := s.CancelSession(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, ErrTaskNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, records)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LockFileName はセッションの実行中に flock で排他ロックを取るファイルです
+const LockFileName = ".lock"
+
+// ErrLocked は別のプロセスがセッションのロックを保持している場合のエラーです
+var ErrLocked = errors.New("session is locked by another process")
+
+// TryLock はセッションディレクトリのロックファイルに排他ロックを取ります
+// ロックは返されたファイルを Close すると解放されます
+// 別のプロセスがロックを保持している場合は ErrLocked を返します
+func TryLock(sessionDir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(sessionDir, LockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock session: %w", err)
+	}
+	return f, nil
+}
+
+// IsLocked はセッションが実行中 (ロックが保持されている) かどうかを返します
+func IsLocked(sessionDir string) bool {
+	f, err := os.Open(filepath.Join(sessionDir, LockFileName))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return errors.Is(err, syscall.EWOULDBLOCK)
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
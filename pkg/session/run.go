@@ -0,0 +1,176 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// セッションディレクトリ (base_dir/<SessionID>) 配下のレイアウト
+const (
+	RepoDirName         = "repo"
+	InstructionFileName = "instruction"
+	EnvFileName         = "env"
+	ScriptFileName      = "goose-execute.sh"
+	RunsDirName         = "runs"
+	RunRecordFileName   = "run.json"
+	TranscriptFileName  = "transcript.log"
+	// GnupgDirName は openpgp で署名する場合にセッションごとに鍵を取り込むディレクトリです
+	GnupgDirName = "gnupg"
+)
+
+// NormalizeID はセッション ID をディレクトリ名として使える形に変換します
+func NormalizeID(sessionID string) string {
+	return strings.ReplaceAll(sessionID, "/", "-")
+}
+
+// Dir はセッションのディレクトリパスを返します
+func Dir(baseDir, sessionID string) string {
+	return filepath.Join(baseDir, NormalizeID(sessionID))
+}
+
+// RunStatus は 1 回の実行の状態を表します
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+	RunStatusTimedOut  RunStatus = "timed_out"
+)
+
+// Run は runs/<n>/run.json に保存される 1 回分の実行記録です
+type Run struct {
+	Number          int           `json:"number"`
+	Status          RunStatus     `json:"status"`
+	StartedAt       time.Time     `json:"started_at"`
+	FinishedAt      time.Time     `json:"finished_at"`
+	Duration        time.Duration `json:"duration"`
+	ExitCode        int           `json:"exit_code"`
+	Error           string        `json:"error,omitempty"`
+	InstructionHash string        `json:"instruction_hash"`
+	Provider        string        `json:"provider"`
+	Model           string        `json:"model"`
+}
+
+// HashInstruction は実行記録に残す指示内容のハッシュを返します
+func HashInstruction(instruction string) string {
+	sum := sha256.Sum256([]byte(instruction))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// RunDir は n 回目の実行のディレクトリパスを返します
+func RunDir(sessionDir string, n int) string {
+	return filepath.Join(sessionDir, RunsDirName, strconv.Itoa(n))
+}
+
+// NewRunDir は次の実行番号のディレクトリを作成し、その番号とパスを返します
+// 番号は 1 から始まり、同時に呼ばれても Mkdir の排他で重複しません
+func NewRunDir(sessionDir string) (int, string, error) {
+	runsDir := filepath.Join(sessionDir, RunsDirName)
+	if err := os.MkdirAll(runsDir, 0755); err != nil {
+		return 0, "", fmt.Errorf("failed to create runs directory: %w", err)
+	}
+	numbers, err := runNumbers(sessionDir)
+	if err != nil {
+		return 0, "", err
+	}
+	n := 1
+	if len(numbers) > 0 {
+		n = numbers[len(numbers)-1] + 1
+	}
+	for {
+		dir := RunDir(sessionDir, n)
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return n, dir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return 0, "", fmt.Errorf("failed to create run directory: %w", err)
+		}
+		n++
+	}
+}
+
+// WriteRun は実行記録を runDir/run.json に書き出します
+// 途中で読まれても壊れた JSON にならないよう一時ファイル経由で置き換えます
+func WriteRun(runDir string, run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+	tmp := filepath.Join(runDir, RunRecordFileName+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(runDir, RunRecordFileName)); err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+	return nil
+}
+
+// ReadRun は n 回目の実行記録を読み込みます
+func ReadRun(sessionDir string, n int) (*Run, error) {
+	data, err := os.ReadFile(filepath.Join(RunDir(sessionDir, n), RunRecordFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run record: %w", err)
+	}
+	run := &Run{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("failed to parse run record: %w", err)
+	}
+	return run, nil
+}
+
+// ReadRuns はセッションの実行記録を番号順に返します
+func ReadRuns(sessionDir string) ([]*Run, error) {
+	numbers, err := runNumbers(sessionDir)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Run, 0, len(numbers))
+	for _, n := range numbers {
+		run, err := ReadRun(sessionDir, n)
+		if err != nil {
+			// 記録の書き込み前に落ちた実行はスキップする
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func runNumbers(sessionDir string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(sessionDir, RunsDirName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read runs directory: %w", err)
+	}
+	var numbers []int
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		n, err := strconv.Atoi(e.Name())
+		if err != nil || n <= 0 {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
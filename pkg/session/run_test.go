@@ -0,0 +1,74 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRunDirAndReadRuns(t *testing.T) {
+	sessionDir := t.TempDir()
+
+	for i := 1; i <= 3; i++ {
+		n, dir, err := NewRunDir(sessionDir)
+		if err != nil {
+			t.Fatalf("NewRunDir failed: %v", err)
+		}
+		if n != i {
+			t.Errorf("NewRunDir() number = %d, expected %d", n, i)
+		}
+		if dir != RunDir(sessionDir, i) {
+			t.Errorf("NewRunDir() dir = %s, expected %s", dir, RunDir(sessionDir, i))
+		}
+		// 2 回目の実行は記録を書く前に落ちたものとする
+		if i == 2 {
+			continue
+		}
+		run := &Run{
+			Number:          n,
+			Status:          RunStatusSucceeded,
+			StartedAt:       time.Now(),
+			Duration:        time.Minute,
+			InstructionHash: HashInstruction("test"),
+			Provider:        "openai",
+			Model:           "gpt-4",
+		}
+		if err := WriteRun(dir, run); err != nil {
+			t.Fatalf("WriteRun failed: %v", err)
+		}
+	}
+
+	runs, err := ReadRuns(sessionDir)
+	if err != nil {
+		t.Fatalf("ReadRuns failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("ReadRuns() returned %d runs, expected 2", len(runs))
+	}
+	if runs[0].Number != 1 || runs[1].Number != 3 {
+		t.Errorf("unexpected run numbers: %d, %d", runs[0].Number, runs[1].Number)
+	}
+	if runs[1].Duration != time.Minute || runs[1].Model != "gpt-4" {
+		t.Errorf("run record was not round-tripped: %+v", runs[1])
+	}
+	if _, err := os.Stat(filepath.Join(RunDir(sessionDir, 1), RunRecordFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary run record was left behind")
+	}
+}
+
+func TestReadRunsWithoutRunsDir(t *testing.T) {
+	runs, err := ReadRuns(t.TempDir())
+	if err != nil {
+		t.Fatalf("ReadRuns failed: %v", err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("expected no runs, got %d", len(runs))
+	}
+}
+
+func TestDir(t *testing.T) {
+	if got := Dir("/base", "org/repo/issues/1"); got != "/base/org-repo-issues-1" {
+		t.Errorf("Dir() = %s", got)
+	}
+}
@@ -0,0 +1,226 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// layoutEntries はセッションディレクトリであることを判定するためのエントリです
+var layoutEntries = []string{
+	RepoDirName,
+	InstructionFileName,
+	EnvFileName,
+	ScriptFileName,
+	RunsDirName,
+}
+
+// Info は base_dir 配下の 1 セッション分の情報です
+type Info struct {
+	ID             string
+	Dir            string
+	SizeBytes      int64
+	LastActivity   time.Time
+	HasRepo        bool
+	HasInstruction bool
+	HasEnv         bool
+	HasScript      bool
+	Locked         bool
+	Runs           []*Run
+}
+
+// LastRun は最新の実行記録を返します。記録がなければ nil を返します
+func (i *Info) LastRun() *Run {
+	if len(i.Runs) == 0 {
+		return nil
+	}
+	return i.Runs[len(i.Runs)-1]
+}
+
+// IsRunning はセッションのロックが保持されている場合に true を返します
+// プロセスが異常終了すると run.json の status は running のまま残るため、ロックで判定します
+func (i *Info) IsRunning() bool {
+	return i.Locked
+}
+
+// List は baseDir 配下のセッションを最終更新が新しい順に返します
+func List(baseDir string) ([]*Info, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read base directory: %w", err)
+	}
+	var infos []*Info
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := inspect(baseDir, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastActivity.After(infos[j].LastActivity)
+	})
+	return infos, nil
+}
+
+// Inspect は指定したセッションの情報を返します
+func Inspect(baseDir, sessionID string) (*Info, error) {
+	id, err := validateID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := inspect(baseDir, id)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	return info, nil
+}
+
+// Remove はセッションディレクトリを削除します
+func Remove(baseDir, sessionID string) error {
+	info, err := Inspect(baseDir, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(info.Dir); err != nil {
+		return fmt.Errorf("failed to remove session directory: %w", err)
+	}
+	return nil
+}
+
+// SelectGarbage は削除対象のセッションを返します
+// 新しい順に keepLast 件は残し、それ以外で最終更新が olderThan より古いものを対象とします
+// 実行中のセッションは対象外です
+func SelectGarbage(infos []*Info, olderThan time.Duration, keepLast int, now time.Time) []*Info {
+	sorted := append([]*Info{}, infos...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].LastActivity.After(sorted[j].LastActivity)
+	})
+	var garbage []*Info
+	for i, info := range sorted {
+		if i < keepLast || info.IsRunning() {
+			continue
+		}
+		if now.Sub(info.LastActivity) < olderThan {
+			continue
+		}
+		garbage = append(garbage, info)
+	}
+	return garbage
+}
+
+// validateID はセッション ID が base_dir の外を指さないことを確認します
+func validateID(sessionID string) (string, error) {
+	id := NormalizeID(sessionID)
+	if id == "" || id == "." || id == ".." || strings.ContainsRune(id, filepath.Separator) {
+		return "", fmt.Errorf("invalid session ID: %q", sessionID)
+	}
+	return id, nil
+}
+
+// inspect はディレクトリがセッションのレイアウトを持たない場合 nil を返します
+func inspect(baseDir, id string) (*Info, error) {
+	dir := filepath.Join(baseDir, id)
+	stat, err := os.Stat(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stat session directory: %w", err)
+	}
+	if !stat.IsDir() {
+		return nil, nil
+	}
+
+	info := &Info{ID: id, Dir: dir, LastActivity: stat.ModTime()}
+	found := false
+	for _, name := range layoutEntries {
+		st, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		found = true
+		if st.ModTime().After(info.LastActivity) {
+			info.LastActivity = st.ModTime()
+		}
+		switch name {
+		case RepoDirName:
+			info.HasRepo = true
+		case InstructionFileName:
+			info.HasInstruction = true
+		case EnvFileName:
+			info.HasEnv = true
+		case ScriptFileName:
+			info.HasScript = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	runs, err := ReadRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	info.Runs = runs
+	info.Locked = IsLocked(dir)
+	if last := info.LastRun(); last != nil {
+		for _, t := range []time.Time{last.StartedAt, last.FinishedAt} {
+			if t.After(info.LastActivity) {
+				info.LastActivity = t
+			}
+		}
+	}
+
+	size, err := diskUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+	info.SizeBytes = size
+	return info, nil
+}
+
+// diskUsage は dir 配下のファイルサイズの合計を返します (シンボリックリンクは辿りません)
+func diskUsage(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 実行中のセッションではファイルが消えることがある
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			total += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate disk usage: %w", err)
+	}
+	return total, nil
+}
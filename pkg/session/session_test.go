@@ -0,0 +1,130 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createSession(t *testing.T, baseDir, id string, modTime time.Time) {
+	t.Helper()
+	dir := filepath.Join(baseDir, id)
+	if err := os.MkdirAll(filepath.Join(dir, RepoDirName), 0755); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, InstructionFileName), []byte("instruction"), 0644); err != nil {
+		t.Fatalf("Failed to create instruction: %v", err)
+	}
+	for _, p := range []string{filepath.Join(dir, RepoDirName), filepath.Join(dir, InstructionFileName), dir} {
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+}
+
+func TestListAndInspect(t *testing.T) {
+	baseDir := t.TempDir()
+	now := time.Now()
+	createSession(t, baseDir, "old", now.Add(-96*time.Hour))
+	createSession(t, baseDir, "new", now.Add(-time.Hour))
+	// セッションのレイアウトを持たないディレクトリは無視される
+	if err := os.MkdirAll(filepath.Join(baseDir, "not-a-session"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	infos, err := List(baseDir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("List() returned %d sessions, expected 2", len(infos))
+	}
+	if infos[0].ID != "new" || infos[1].ID != "old" {
+		t.Errorf("List() is not sorted by last activity: %s, %s", infos[0].ID, infos[1].ID)
+	}
+	if !infos[0].HasRepo || !infos[0].HasInstruction || infos[0].HasEnv {
+		t.Errorf("unexpected layout: %+v", infos[0])
+	}
+	if infos[0].SizeBytes != int64(len("instruction")) {
+		t.Errorf("SizeBytes = %d, expected %d", infos[0].SizeBytes, len("instruction"))
+	}
+
+	if _, err := Inspect(baseDir, "not-a-session"); err == nil {
+		t.Errorf("expected error for directory without session layout")
+	}
+	if _, err := Inspect(baseDir, ".."); err == nil {
+		t.Errorf("expected error for session ID outside base dir")
+	}
+}
+
+func TestSelectGarbage(t *testing.T) {
+	now := time.Now()
+	infos := []*Info{
+		{ID: "a", LastActivity: now.Add(-1 * time.Hour)},
+		{ID: "b", LastActivity: now.Add(-80 * time.Hour)},
+		{ID: "c", LastActivity: now.Add(-90 * time.Hour)},
+		{ID: "d", LastActivity: now.Add(-100 * time.Hour), Locked: true},
+	}
+
+	testCases := []struct {
+		name     string
+		keepLast int
+		expected []string
+	}{
+		{name: "keep-last なし", keepLast: 0, expected: []string{"b", "c"}},
+		{name: "keep-last で新しいものを残す", keepLast: 2, expected: []string{"c"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SelectGarbage(infos, 72*time.Hour, tc.keepLast, now)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("SelectGarbage() returned %d sessions, expected %d", len(got), len(tc.expected))
+			}
+			for i, id := range tc.expected {
+				if got[i].ID != id {
+					t.Errorf("SelectGarbage()[%d] = %s, expected %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	sessionDir := t.TempDir()
+
+	f, err := TryLock(sessionDir)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+	if !IsLocked(sessionDir) {
+		t.Errorf("IsLocked() = false while lock is held")
+	}
+	if _, err := TryLock(sessionDir); !errors.Is(err, ErrLocked) {
+		t.Errorf("second TryLock error = %v, expected ErrLocked", err)
+	}
+
+	f.Close()
+	if IsLocked(sessionDir) {
+		t.Errorf("IsLocked() = true after lock was released")
+	}
+	f, err = TryLock(sessionDir)
+	if err != nil {
+		t.Fatalf("TryLock after release failed: %v", err)
+	}
+	f.Close()
+}
+
+func TestRemove(t *testing.T) {
+	baseDir := t.TempDir()
+	createSession(t, baseDir, "org-repo-issues-1", time.Now())
+
+	if err := Remove(baseDir, "org/repo/issues/1"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "org-repo-issues-1")); !os.IsNotExist(err) {
+		t.Errorf("session directory was not removed")
+	}
+}
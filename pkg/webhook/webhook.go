@@ -0,0 +1,365 @@
+// Package webhook は GitHub の Webhook を受け取り、イベントから直接セッションを開始します
+//
+// 署名 (X-Hub-Signature-256) を検証したうえで、次のイベントを ExecuteTaskRequest に変換して投入します
+//
+//	issues                       トリガーのラベルが付いた、またはメンションを含む issue が作成された
+//	pull_request                 トリガーのラベルが付いた
+//	issue_comment                issue/PR にメンションを含むコメントが投稿された
+//	pull_request_review_comment  PR の差分にメンションを含むレビューコメントが投稿された
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/goose"
+	"github.com/kommon-ai/goose-connect/pkg/server"
+)
+
+// maxPayloadBytes は受け付けるペイロードの上限です (GitHub が送るペイロードの上限は 25MB)
+const maxPayloadBytes = 25 << 20
+
+// ErrInvalidSignature は X-Hub-Signature-256 がないか、ペイロードと一致しない場合のエラーです
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Submitter はタスクを投入します (server.RemoteAgentServer が実装します)
+type Submitter interface {
+	Submit(msg *proto.ExecuteTaskRequest) (server.TaskRecord, error)
+}
+
+// Receiver は GitHub の Webhook を受け取る http.Handler です
+type Receiver struct {
+	// Secret は Webhook の設定の Secret です
+	Secret    []byte
+	Submitter Submitter
+	Trigger   config.WebhookTrigger
+
+	// Provider, Model, APIKey はセッションの LLM です
+	Provider string
+	Model    string
+	APIKey   string
+	// Token はリクエストに載せる GitHub のトークンです (GitHub App を使う場合は空で構いません)
+	Token string
+
+	// Client は PR へのコメントからブランチを調べるための GitHub API のクライアントを返します
+	Client func(ctx context.Context, msg *proto.ExecuteTaskRequest) (*github.Client, error)
+}
+
+// job はイベントから導出したセッションの内容です
+type job struct {
+	// htmlURL は issue または PR の URL です (https://github.com/org/repo/issues/123 など)
+	htmlURL     string
+	repo        string
+	branch      string
+	instruction string
+}
+
+// ignored はセッションを開始しないイベントの理由です
+type ignored string
+
+func (i ignored) Error() string {
+	return string(i)
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(req.Body, maxPayloadBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := r.verify(req.Header.Get(github.SHA256SignatureHeader), payload); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	eventType := github.WebHookType(req)
+	delivery := github.DeliveryID(req)
+	if eventType == "ping" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "pong"})
+		return
+	}
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		// 未知のイベントは購読の設定の誤りなので、再送されないよう成功として扱う
+		r.ignore(w, delivery, ignored(fmt.Sprintf("unsupported event %q", eventType)))
+		return
+	}
+
+	j, reason := r.job(event)
+	if reason != "" {
+		r.ignore(w, delivery, reason)
+		return
+	}
+	msg, err := r.request(req.Context(), j)
+	if errors.As(err, &reason) {
+		r.ignore(w, delivery, reason)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to handle webhook %s (%s): %v", delivery, eventType, err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rec, err := r.Submitter.Submit(msg)
+	if err != nil {
+		log.Printf("Failed to submit task for webhook %s (%s): %v", delivery, eventType, err)
+		switch {
+		case errors.Is(err, server.ErrQueueFull):
+			writeError(w, http.StatusTooManyRequests, err)
+		case errors.Is(err, server.ErrShuttingDown):
+			writeError(w, http.StatusServiceUnavailable, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	log.Printf("Webhook %s (%s) started task %s for session %s", delivery, eventType, rec.ID, rec.SessionID)
+	w.Header().Set(server.TaskIDHeader, rec.ID)
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+// verify は signature (sha256=<hex>) が payload の HMAC-SHA256 と一致することを確認します
+func (r *Receiver) verify(signature string, payload []byte) error {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, r.Secret)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (r *Receiver) ignore(w http.ResponseWriter, delivery string, reason ignored) {
+	log.Printf("Ignoring webhook %s: %s", delivery, reason)
+	writeJSON(w, http.StatusOK, map[string]string{"ignored": string(reason)})
+}
+
+// job はイベントからセッションの内容を導出します。セッションを開始しない場合は理由を返します
+func (r *Receiver) job(event any) (*job, ignored) {
+	switch e := event.(type) {
+	case *github.IssuesEvent:
+		issue := e.GetIssue()
+		switch e.GetAction() {
+		case "labeled":
+			if !r.labeled(e.GetLabel()) {
+				return nil, "label is not the trigger label"
+			}
+		case "opened":
+			if reason := r.allowed(e.GetSender(), issue.GetAuthorAssociation()); reason != "" {
+				return nil, reason
+			}
+			if _, ok := mentioned(issue.GetBody(), r.Trigger.Mention); !ok {
+				return nil, "issue does not mention the trigger"
+			}
+		default:
+			return nil, ignored("unsupported issues action " + e.GetAction())
+		}
+		return &job{
+			htmlURL:     issue.GetHTMLURL(),
+			repo:        e.GetRepo().GetFullName(),
+			instruction: fmt.Sprintf("issue #%d の対応を依頼します。\nタイトル: %s\n\n%s", issue.GetNumber(), issue.GetTitle(), issue.GetBody()),
+		}, ""
+
+	case *github.PullRequestEvent:
+		pr := e.GetPullRequest()
+		if e.GetAction() != "labeled" {
+			return nil, ignored("unsupported pull_request action " + e.GetAction())
+		}
+		if !r.labeled(e.GetLabel()) {
+			return nil, "label is not the trigger label"
+		}
+		if reason := sameRepo(pr); reason != "" {
+			return nil, reason
+		}
+		return &job{
+			htmlURL:     pr.GetHTMLURL(),
+			repo:        e.GetRepo().GetFullName(),
+			branch:      pr.GetHead().GetRef(),
+			instruction: fmt.Sprintf("PR #%d の対応を依頼します。\nタイトル: %s\n\n%s", pr.GetNumber(), pr.GetTitle(), pr.GetBody()),
+		}, ""
+
+	case *github.IssueCommentEvent:
+		issue, comment := e.GetIssue(), e.GetComment()
+		if e.GetAction() != "created" {
+			return nil, ignored("unsupported issue_comment action " + e.GetAction())
+		}
+		if reason := r.allowed(e.GetSender(), comment.GetAuthorAssociation()); reason != "" {
+			return nil, reason
+		}
+		text, ok := mentioned(comment.GetBody(), r.Trigger.Mention)
+		if !ok {
+			return nil, "comment does not mention the trigger"
+		}
+		kind := "issue"
+		if issue.IsPullRequest() {
+			kind = "PR"
+		}
+		// PR のブランチはペイロードにないため、request で API から調べる
+		return &job{
+			htmlURL: issue.GetHTMLURL(),
+			repo:    e.GetRepo().GetFullName(),
+			instruction: fmt.Sprintf("%s #%d「%s」へのコメントで依頼されました。\nコメント: %s\n\n%s",
+				kind, issue.GetNumber(), issue.GetTitle(), comment.GetHTMLURL(), text),
+		}, ""
+
+	case *github.PullRequestReviewCommentEvent:
+		pr, comment := e.GetPullRequest(), e.GetComment()
+		if e.GetAction() != "created" {
+			return nil, ignored("unsupported pull_request_review_comment action " + e.GetAction())
+		}
+		if reason := r.allowed(e.GetSender(), comment.GetAuthorAssociation()); reason != "" {
+			return nil, reason
+		}
+		text, ok := mentioned(comment.GetBody(), r.Trigger.Mention)
+		if !ok {
+			return nil, "comment does not mention the trigger"
+		}
+		if reason := sameRepo(pr); reason != "" {
+			return nil, reason
+		}
+		return &job{
+			htmlURL: pr.GetHTMLURL(),
+			repo:    e.GetRepo().GetFullName(),
+			branch:  pr.GetHead().GetRef(),
+			instruction: fmt.Sprintf("PR #%d「%s」のレビューコメントで依頼されました。\nコメント: %s\nファイル: %s (%d 行目)\n\n```diff\n%s\n```\n\n%s",
+				pr.GetNumber(), pr.GetTitle(), comment.GetHTMLURL(), comment.GetPath(), comment.GetLine(), comment.GetDiffHunk(), text),
+		}, ""
+
+	default:
+		return nil, ignored(fmt.Sprintf("unsupported event %T", event))
+	}
+}
+
+// labeled は label がトリガーのラベルかどうかを返します
+func (r *Receiver) labeled(label *github.Label) bool {
+	return r.Trigger.Label != "" && strings.EqualFold(label.GetName(), r.Trigger.Label)
+}
+
+// allowed はメンションでセッションを開始できる作成者かどうかを確かめ、できない場合は理由を返します
+// goose 自身のコメントなど、ボットの投稿からはセッションを開始しない
+func (r *Receiver) allowed(sender *github.User, association string) ignored {
+	if sender.GetType() == "Bot" {
+		return ignored("sender is a bot: " + sender.GetLogin())
+	}
+	if !slices.ContainsFunc(r.Trigger.Associations, func(a string) bool { return strings.EqualFold(a, association) }) {
+		return ignored("author association is not allowed: " + association)
+	}
+	return ""
+}
+
+// sameRepo はフォークからの PR を除外します。フォークのブランチにはプッシュできない
+func sameRepo(pr *github.PullRequest) ignored {
+	head, base := pr.GetHead().GetRepo().GetFullName(), pr.GetBase().GetRepo().GetFullName()
+	if head == "" || base == "" || strings.EqualFold(head, base) {
+		return ""
+	}
+	return ignored("pull request from fork is not supported: " + head)
+}
+
+// mentioned は body が mention を単語として含む場合に、mention を取り除いた本文を返します
+func mentioned(body, mention string) (string, bool) {
+	if mention == "" {
+		return "", false
+	}
+	lower, target := strings.ToLower(body), strings.ToLower(mention)
+	if len(lower) != len(body) || len(target) != len(mention) {
+		// 小文字にするとバイト長が変わる文字を含む場合は大文字と小文字を区別する
+		lower, target = body, mention
+	}
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], target)
+		if i < 0 {
+			return "", false
+		}
+		start, end := offset+i, offset+i+len(target)
+		// @goose-bot などの別のメンションとは区別する
+		if end == len(body) || !isNameByte(body[end]) {
+			return strings.TrimSpace(body[:start] + body[end:]), true
+		}
+		offset = end
+	}
+}
+
+// isNameByte は c が GitHub のユーザー名に使える文字かどうかを返します
+func isNameByte(c byte) bool {
+	return c == '-' || c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// request は job から ExecuteTaskRequest を作成します
+// セッション ID は issue/PR の URL のパス (org/repo/issues/123 など) です
+func (r *Receiver) request(ctx context.Context, j *job) (*proto.ExecuteTaskRequest, error) {
+	gh := &goose.GooseGitHub{InstallationToken: r.Token, Repo: j.repo, BranchName: j.branch}
+	if err := gh.ImportEventURL(j.htmlURL); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(j.htmlURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event URL: %w", err)
+	}
+	msg := &proto.ExecuteTaskRequest{
+		SessionId:   strings.Trim(u.Path, "/"),
+		Instruction: j.instruction,
+		Provider:    &proto.ProviderInfo{ProviderName: r.Provider, ModelName: r.Model, ApiKey: r.APIKey},
+		Github:      goose.GitHubToProto(gh),
+	}
+	if gh.PRNumber > 0 && gh.BranchName == "" {
+		branch, err := r.headBranch(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		msg.Github.BranchName = branch
+	}
+	return msg, nil
+}
+
+// headBranch は msg の PR のブランチを返します
+func (r *Receiver) headBranch(ctx context.Context, msg *proto.ExecuteTaskRequest) (string, error) {
+	if r.Client == nil {
+		return "", fmt.Errorf("no GitHub client to look up the branch of pull request #%d", msg.Github.PrNumber)
+	}
+	client, err := r.Client(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	owner, name, _ := strings.Cut(msg.Github.Repo, "/")
+	pr, _, err := client.PullRequests.Get(ctx, owner, name, int(msg.Github.PrNumber))
+	if err != nil {
+		return "", fmt.Errorf("failed to get pull request #%d: %w", msg.Github.PrNumber, err)
+	}
+	if reason := sameRepo(pr); reason != "" {
+		return "", reason
+	}
+	return pr.GetHead().GetRef(), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
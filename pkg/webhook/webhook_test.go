@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/kommon-ai/agent-connect/gen/proto"
+	"github.com/kommon-ai/goose-connect/pkg/config"
+	"github.com/kommon-ai/goose-connect/pkg/server"
+)
+
+// fakeSubmitter は投入されたリクエストを記録します
+type fakeSubmitter struct {
+	msgs []*proto.ExecuteTaskRequest
+}
+
+func (s *fakeSubmitter) Submit(msg *proto.ExecuteTaskRequest) (server.TaskRecord, error) {
+	s.msgs = append(s.msgs, msg)
+	return server.TaskRecord{ID: "task-1", SessionID: msg.SessionId}, nil
+}
+
+const secret = "webhook-secret"
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	repoJSON = `"repository":{"full_name":"org/repo"}`
+	member   = `"sender":{"login":"alice","type":"User"}`
+	prJSON   = `{"number":8,"title":"Fix","html_url":"https://github.com/org/repo/pull/8",` +
+		`"head":{"ref":"feature","repo":{"full_name":"org/repo"}},"base":{"repo":{"full_name":"org/repo"}}}`
+)
+
+func TestReceiver(t *testing.T) {
+	// PR へのコメントではブランチを API から調べる
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/org/repo/pulls/8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(prJSON))
+	})
+	api := httptest.NewServer(mux)
+	defer api.Close()
+	client := func(ctx context.Context, msg *proto.ExecuteTaskRequest) (*github.Client, error) {
+		return github.NewClient(api.Client()).WithEnterpriseURLs(api.URL, api.URL)
+	}
+
+	testCases := []struct {
+		name        string
+		event       string
+		payload     string
+		signature   string
+		wantStatus  int
+		wantSession string
+		wantBranch  string
+		wantPR      int32
+		wantIssue   int32
+		// wantInstruction は指示に含まれるべき文字列です
+		wantInstruction []string
+	}{
+		{
+			name:  "トリガーのラベルが付いた issue",
+			event: "issues",
+			payload: `{"action":"labeled","label":{"name":"Goose"},` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":7,"title":"Add docs","body":"Please add docs","html_url":"https://github.com/org/repo/issues/7"}}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/issues/7",
+			wantIssue:       7,
+			wantInstruction: []string{"issue #7", "Add docs", "Please add docs"},
+		},
+		{
+			name:  "他のラベルは無視する",
+			event: "issues",
+			payload: `{"action":"labeled","label":{"name":"bug"},` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":7,"html_url":"https://github.com/org/repo/issues/7"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "メンションを含む issue の作成",
+			event: "issues",
+			payload: `{"action":"opened",` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":9,"title":"Bug","body":"@goose fix it","author_association":"OWNER","html_url":"https://github.com/org/repo/issues/9"}}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/issues/9",
+			wantIssue:       9,
+			wantInstruction: []string{"@goose fix it"},
+		},
+		{
+			name:  "トリガーのラベルが付いた PR",
+			event: "pull_request",
+			payload: `{"action":"labeled","label":{"name":"goose"},` + repoJSON + `,` + member + `,` +
+				`"pull_request":` + prJSON + `}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/pull/8",
+			wantBranch:      "feature",
+			wantPR:          8,
+			wantInstruction: []string{"PR #8", "Fix"},
+		},
+		{
+			name:  "issue へのメンション",
+			event: "issue_comment",
+			payload: `{"action":"created",` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":7,"title":"Add docs","html_url":"https://github.com/org/repo/issues/7"},` +
+				`"comment":{"body":"@Goose please write README","author_association":"MEMBER","html_url":"https://github.com/org/repo/issues/7#issuecomment-1"}}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/issues/7",
+			wantIssue:       7,
+			wantInstruction: []string{"please write README", "issuecomment-1"},
+		},
+		{
+			name:  "PR へのメンションはブランチを API から調べる",
+			event: "issue_comment",
+			payload: `{"action":"created",` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":8,"title":"Fix","html_url":"https://github.com/org/repo/pull/8","pull_request":{"url":"x"}},` +
+				`"comment":{"body":"@goose rebase","author_association":"COLLABORATOR"}}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/pull/8",
+			wantBranch:      "feature",
+			wantPR:          8,
+			wantInstruction: []string{"PR #8", "rebase"},
+		},
+		{
+			name:  "レビューコメントは差分を指示に含める",
+			event: "pull_request_review_comment",
+			payload: `{"action":"created",` + repoJSON + `,` + member + `,"pull_request":` + prJSON + `,` +
+				`"comment":{"body":"@goose rename this","author_association":"MEMBER","path":"main.go","line":12,"diff_hunk":"@@ -1 +1 @@\n-a\n+b"}}`,
+			wantStatus:      http.StatusAccepted,
+			wantSession:     "org/repo/pull/8",
+			wantBranch:      "feature",
+			wantPR:          8,
+			wantInstruction: []string{"main.go (12 行目)", "+b", "rename this"},
+		},
+		{
+			name:  "権限のない作成者のメンションは無視する",
+			event: "issue_comment",
+			payload: `{"action":"created",` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":7,"html_url":"https://github.com/org/repo/issues/7"},` +
+				`"comment":{"body":"@goose run","author_association":"NONE"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "ボットのコメントは無視する",
+			event: "issue_comment",
+			payload: `{"action":"created",` + repoJSON + `,"sender":{"login":"goose[bot]","type":"Bot"},` +
+				`"issue":{"number":7,"html_url":"https://github.com/org/repo/issues/7"},` +
+				`"comment":{"body":"@goose run","author_association":"MEMBER"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "別のユーザーへのメンションは無視する",
+			event: "issue_comment",
+			payload: `{"action":"created",` + repoJSON + `,` + member + `,` +
+				`"issue":{"number":7,"html_url":"https://github.com/org/repo/issues/7"},` +
+				`"comment":{"body":"@goose-bot run","author_association":"MEMBER"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "フォークからの PR は無視する",
+			event: "pull_request",
+			payload: `{"action":"labeled","label":{"name":"goose"},` + repoJSON + `,` + member + `,` +
+				`"pull_request":{"number":8,"html_url":"https://github.com/org/repo/pull/8",` +
+				`"head":{"ref":"main","repo":{"full_name":"someone/repo"}},"base":{"repo":{"full_name":"org/repo"}}}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "未対応のイベントは無視する",
+			event:      "star",
+			payload:    `{"action":"created"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "署名が一致しない",
+			event:      "issues",
+			payload:    `{"action":"labeled","label":{"name":"goose"}}`,
+			signature:  sign(`{}`),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "SHA-1 の署名は受け付けない",
+			event:      "issues",
+			payload:    `{"action":"labeled","label":{"name":"goose"}}`,
+			signature:  "sha1=0000",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			submitter := &fakeSubmitter{}
+			receiver := &Receiver{
+				Secret:    []byte(secret),
+				Submitter: submitter,
+				Trigger:   config.WebhookTrigger{Label: "goose", Mention: "@goose", Associations: []string{"OWNER", "MEMBER", "COLLABORATOR"}},
+				Provider:  "anthropic",
+				Model:     "claude",
+				APIKey:    "sk-key",
+				Token:     "ghp_token",
+				Client:    client,
+			}
+			signature := tc.signature
+			if signature == "" {
+				signature = sign(tc.payload)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tc.payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", tc.event)
+			req.Header.Set(github.SHA256SignatureHeader, signature)
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if tc.wantSession == "" {
+				if len(submitter.msgs) != 0 {
+					t.Errorf("task must not be submitted: %v", submitter.msgs)
+				}
+				return
+			}
+			if len(submitter.msgs) != 1 {
+				t.Fatalf("expected one task, got %d", len(submitter.msgs))
+			}
+			msg := submitter.msgs[0]
+			if msg.SessionId != tc.wantSession {
+				t.Errorf("session ID = %q, want %q", msg.SessionId, tc.wantSession)
+			}
+			gh := msg.GetGithub()
+			if gh.GetRepo() != "org/repo" || gh.GetApiToken() != "ghp_token" || gh.GetFullRepoUrl() != "https://github.com/org/repo" {
+				t.Errorf("unexpected GitHub info: %v", gh)
+			}
+			if gh.GetBranchName() != tc.wantBranch || gh.GetPrNumber() != tc.wantPR || gh.GetIssueNumber() != tc.wantIssue {
+				t.Errorf("branch, PR, issue = %q, %d, %d, want %q, %d, %d",
+					gh.GetBranchName(), gh.GetPrNumber(), gh.GetIssueNumber(), tc.wantBranch, tc.wantPR, tc.wantIssue)
+			}
+			if p := msg.GetProvider(); p.GetProviderName() != "anthropic" || p.GetModelName() != "claude" || p.GetApiKey() != "sk-key" {
+				t.Errorf("unexpected provider: %v", p)
+			}
+			for _, want := range tc.wantInstruction {
+				if !strings.Contains(msg.Instruction, want) {
+					t.Errorf("instruction does not contain %q:\n%s", want, msg.Instruction)
+				}
+			}
+			if rec.Header().Get(server.TaskIDHeader) != "task-1" {
+				t.Errorf("task ID header is not set: %v", rec.Header())
+			}
+		})
+	}
+}
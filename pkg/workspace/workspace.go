@@ -0,0 +1,382 @@
+// Package workspace はセッションの作業ディレクトリ (<session>/repo) を git で準備します
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Op は失敗した操作の種類です
+type Op string
+
+const (
+	OpClone    Op = "clone"
+	OpFetch    Op = "fetch"
+	OpRemote   Op = "remote"
+	OpReset    Op = "reset"
+	OpCheckout Op = "checkout"
+	OpConfig   Op = "config"
+	OpDiff     Op = "diff"
+)
+
+// ErrBranchNotFound は指定されたブランチがローカルにもリモートにも存在しない場合のエラーです
+var ErrBranchNotFound = errors.New("branch not found")
+
+// Error は git の操作の失敗を表します
+type Error struct {
+	Op Op
+	// Args は実行した git の引数です (URL の認証情報は取り除かれます)
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("workspace %s failed: git %s: %v", e.Op, strings.Join(e.Args, " "), e.Err)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Options は作業ディレクトリの準備内容です
+type Options struct {
+	// Dir は作業ディレクトリのパスです
+	Dir string
+	// RepoURL は clone/fetch するリポジトリの URL です
+	// 認証情報は URL に含めず CredentialHelper で渡します
+	RepoURL string
+	// CredentialHelper はリポジトリにローカルに設定する credential.helper です
+	// 空でない場合、HOME やシステムの設定の credential.helper は使用しません
+	CredentialHelper string
+	// Branch はチェックアウトする既存のブランチ (PR のブランチなど) です
+	Branch string
+	// NewBranch は Branch が空の場合に、リモートのデフォルトブランチから作成するブランチです
+	// 既に存在する場合はそのままチェックアウトします
+	NewBranch string
+	// Reset は前回の実行で残った未コミットの変更と追跡されていないファイルを破棄します
+	Reset bool
+	// Env は git に追加で渡す KEY=VALUE 形式の環境変数です (credential helper が参照するトークンなど)
+	Env []string
+	// UserName, UserEmail はリポジトリにローカルに設定するコミットの作成者です
+	UserName  string
+	UserEmail string
+	// Signing が nil の場合はコミットに署名しません
+	Signing *Signing
+}
+
+// Signing はコミットの署名の設定です
+type Signing struct {
+	// Format は gpg.format に設定する ssh または openpgp です
+	Format string
+	// Key は user.signingkey に設定する値です (ssh の場合は鍵のパス、openpgp の場合は鍵の ID)
+	Key string
+}
+
+// signingKeys は署名のためにリポジトリに設定するキーです
+var signingKeys = []string{"gpg.format", "user.signingkey", "commit.gpgsign", "tag.gpgsign"}
+
+// Result は準備した作業ディレクトリの状態です
+type Result struct {
+	Dir    string
+	Branch string
+	Head   string
+	// Cloned は今回新たに clone したかどうかです
+	Cloned bool
+	// Diverged はローカルのブランチがリモートから分岐していたため、リモートのブランチに合わせたかどうかです
+	Diverged bool
+}
+
+// Prepare は opts に従って作業ディレクトリを準備します
+// 存在しない場合は clone し、既に存在する場合は origin を RepoURL に向けて fetch します
+func Prepare(ctx context.Context, opts Options) (*Result, error) {
+	if opts.Dir == "" || opts.RepoURL == "" {
+		return nil, fmt.Errorf("workspace dir and repo URL are required")
+	}
+	result := &Result{Dir: opts.Dir}
+	r := runner{dir: opts.Dir, env: opts.Env}
+
+	if _, err := os.Stat(filepath.Join(opts.Dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(opts.Dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create workspace parent directory: %w", err)
+		}
+		args := append(credentialArgs(opts.CredentialHelper), "clone", "--origin", "origin", opts.RepoURL, opts.Dir)
+		if _, err := (runner{env: opts.Env}).git(ctx, OpClone, args...); err != nil {
+			return nil, err
+		}
+		result.Cloned = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to stat workspace: %w", err)
+	} else {
+		if err := setRemote(ctx, r, opts.RepoURL); err != nil {
+			return nil, err
+		}
+		if err := configureCredentialHelper(ctx, r, opts.CredentialHelper); err != nil {
+			return nil, err
+		}
+		if _, err := r.git(ctx, OpFetch, "fetch", "--prune", "origin"); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Cloned {
+		if err := configureCredentialHelper(ctx, r, opts.CredentialHelper); err != nil {
+			return nil, err
+		}
+	}
+	if err := configureIdentity(ctx, r, opts); err != nil {
+		return nil, err
+	}
+	if opts.Reset && !result.Cloned {
+		if _, err := r.git(ctx, OpReset, "reset", "--hard", "--quiet"); err != nil {
+			return nil, err
+		}
+		if _, err := r.git(ctx, OpReset, "clean", "-fd", "--quiet"); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	switch {
+	case opts.Branch != "":
+		result.Diverged, err = checkoutExisting(ctx, r, opts.Branch)
+	case opts.NewBranch != "":
+		result.Diverged, err = checkoutNew(ctx, r, opts.NewBranch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Branch, err = r.git(ctx, OpCheckout, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+		return nil, err
+	}
+	if result.Head, err = r.git(ctx, OpCheckout, "rev-parse", "HEAD"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ChangedFiles は dir の作業ツリーで base のコミットから変更、追加されたファイルのパスを返します
+// コミット済みの変更、未コミットの変更、無視されていない未追跡のファイルを含みます
+func ChangedFiles(ctx context.Context, dir, base string) ([]string, error) {
+	r := runner{dir: dir}
+	diff, err := r.git(ctx, OpDiff, "diff", "--name-only", "-z", base)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := r.git(ctx, OpDiff, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, name := range strings.Split(diff+"\x00"+untracked, "\x00") {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func setRemote(ctx context.Context, r runner, repoURL string) error {
+	if _, err := r.git(ctx, OpRemote, "remote", "get-url", "origin"); err != nil {
+		_, err = r.git(ctx, OpRemote, "remote", "add", "origin", repoURL)
+		return err
+	}
+	_, err := r.git(ctx, OpRemote, "remote", "set-url", "origin", repoURL)
+	return err
+}
+
+// credentialArgs はリポジトリの外で実行する git に helper だけを使わせる -c オプションを返します
+// 空の値で HOME やシステムの設定の credential.helper を打ち消してから helper を追加します
+func credentialArgs(helper string) []string {
+	if helper == "" {
+		return nil
+	}
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + helper}
+}
+
+// configureCredentialHelper は helper をリポジトリのローカル設定の credential.helper にします
+func configureCredentialHelper(ctx context.Context, r runner, helper string) error {
+	if helper == "" {
+		return nil
+	}
+	if _, err := r.git(ctx, OpConfig, "config", "--local", "--unset-all", "credential.helper"); err != nil && !isExitCode(err, 5) {
+		return err
+	}
+	for _, value := range []string{"", helper} {
+		if _, err := r.git(ctx, OpConfig, "config", "--local", "--add", "credential.helper", value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureIdentity はコミットの作成者と署名をリポジトリのローカル設定に書き込みます
+// 同じ HOME を共有する他のセッションに影響しないよう --global には書き込みません
+func configureIdentity(ctx context.Context, r runner, opts Options) error {
+	values := map[string]string{"user.name": opts.UserName, "user.email": opts.UserEmail}
+	if opts.Signing != nil {
+		if opts.Signing.Format != "ssh" && opts.Signing.Format != "openpgp" {
+			return &Error{Op: OpConfig, Args: []string{"config", "gpg.format", opts.Signing.Format}, Err: fmt.Errorf("unsupported signing format: %s", opts.Signing.Format)}
+		}
+		values["gpg.format"] = opts.Signing.Format
+		values["user.signingkey"] = opts.Signing.Key
+		values["commit.gpgsign"] = "true"
+		values["tag.gpgsign"] = "true"
+	} else {
+		// 以前の実行で設定した署名を取り除く
+		for _, key := range signingKeys {
+			if _, err := r.git(ctx, OpConfig, "config", "--local", "--unset-all", key); err != nil && !isExitCode(err, 5) {
+				return err
+			}
+		}
+	}
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, err := r.git(ctx, OpConfig, "config", "--local", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isExitCode は err が git の終了コード code によるエラーかどうかを返します
+func isExitCode(err error, code int) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == code
+}
+
+// checkoutExisting は既存のブランチをチェックアウトし、リモートの変更を早送りで取り込みます
+// force-push などでリモートから分岐している場合は、ローカルのブランチをリモートのブランチに合わせて diverged を返します
+// セッションの作業ディレクトリは使い捨てのため、分岐したローカルのコミットは破棄します
+func checkoutExisting(ctx context.Context, r runner, branch string) (diverged bool, err error) {
+	local := refExists(ctx, r, "refs/heads/"+branch)
+	remote := refExists(ctx, r, "refs/remotes/origin/"+branch)
+	switch {
+	case local:
+		if _, err := r.git(ctx, OpCheckout, "checkout", "--quiet", branch); err != nil {
+			return false, err
+		}
+		if !remote {
+			return false, nil
+		}
+		if !isAncestor(ctx, r, "HEAD", "origin/"+branch) && !isAncestor(ctx, r, "origin/"+branch, "HEAD") {
+			_, err := r.git(ctx, OpReset, "reset", "--hard", "--quiet", "origin/"+branch)
+			return err == nil, err
+		}
+		_, err := r.git(ctx, OpCheckout, "merge", "--ff-only", "--quiet", "origin/"+branch)
+		return false, err
+	case remote:
+		_, err := r.git(ctx, OpCheckout, "checkout", "--quiet", "--track", "-b", branch, "origin/"+branch)
+		return false, err
+	}
+	return false, &Error{Op: OpCheckout, Args: []string{"checkout", branch}, Err: fmt.Errorf("%w: %s", ErrBranchNotFound, branch)}
+}
+
+// checkoutNew は branch が無ければリモートのデフォルトブランチから作成してチェックアウトします
+func checkoutNew(ctx context.Context, r runner, branch string) (diverged bool, err error) {
+	if refExists(ctx, r, "refs/heads/"+branch) {
+		_, err := r.git(ctx, OpCheckout, "checkout", "--quiet", branch)
+		return false, err
+	}
+	if refExists(ctx, r, "refs/remotes/origin/"+branch) {
+		return checkoutExisting(ctx, r, branch)
+	}
+	base := "origin/HEAD"
+	if !refExists(ctx, r, "refs/remotes/origin/HEAD") {
+		// 既存の作業ディレクトリに origin を追加した場合は origin/HEAD が無いため、リモートに問い合わせる
+		if _, err := r.git(ctx, OpRemote, "remote", "set-head", "origin", "--auto"); err != nil {
+			return false, err
+		}
+	}
+	_, err = r.git(ctx, OpCheckout, "checkout", "--quiet", "--no-track", "-b", branch, base)
+	return false, err
+}
+
+// isAncestor は commit が descendant の祖先 (または同じコミット) かどうかを返します
+func isAncestor(ctx context.Context, r runner, commit, descendant string) bool {
+	_, err := r.git(ctx, OpCheckout, "merge-base", "--is-ancestor", commit, descendant)
+	return err == nil
+}
+
+func refExists(ctx context.Context, r runner, ref string) bool {
+	_, err := r.git(ctx, OpCheckout, "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// runner は作業ディレクトリ dir で、追加の環境変数 env を渡して git を実行します
+// dir が空の場合はカレントディレクトリで実行します (clone)
+type runner struct {
+	dir string
+	env []string
+}
+
+// git は git コマンドを実行し、標準出力を返します
+// 認証情報の入力を求めて止まらないよう、端末からの入力は無効にします
+func (r runner) git(ctx context.Context, op Op, args ...string) (string, error) {
+	fullArgs := args
+	if r.dir != "" {
+		fullArgs = append([]string{"-C", r.dir}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", fullArgs...)
+	cmd.Env = append(append(os.Environ(), r.env...), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", &Error{
+			Op:     op,
+			Args:   redactArgs(args),
+			Stderr: redactURLs(strings.TrimSpace(stderr.String())),
+			Err:    err,
+		}
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// redactArgs は引数に含まれる URL の認証情報を取り除きます
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, a := range args {
+		redacted[i] = redactURL(a)
+	}
+	return redacted
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = url.User("***")
+	return u.String()
+}
+
+// redactURLs は git のエラー出力中の URL の認証情報を取り除きます
+func redactURLs(s string) string {
+	fields := strings.Fields(s)
+	for _, f := range fields {
+		trimmed := strings.Trim(f, `'".,:`)
+		if r := redactURL(trimmed); r != trimmed {
+			s = strings.ReplaceAll(s, trimmed, r)
+		}
+	}
+	return s
+}